@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// resolveModel returns the model the name is a model-aliases shortcut for,
+// or the name itself.
+func (c config) resolveModel(name string) string {
+	if full, ok := c.ModelAliases[name]; ok {
+		return full
+	}
+	return name
+}
+
+// modelSuggestions returns the names of the configured models and aliases
+// closest to the unknown name, best first.
+func (c config) modelSuggestions(name string) []string {
+	const maxSuggestions = 3
+	type candidate struct {
+		name string
+		dist int
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	consider := func(s string) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		d := editDistance(strings.ToLower(name), strings.ToLower(s))
+		if strings.HasPrefix(strings.ToLower(s), strings.ToLower(name)) {
+			d = 1
+		}
+		if d <= len(name)/3+1 {
+			candidates = append(candidates, candidate{s, d})
+		}
+	}
+	for s := range c.Models {
+		consider(s)
+	}
+	for s := range c.ModelAliases {
+		consider(s)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
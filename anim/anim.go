@@ -0,0 +1,457 @@
+// Package anim is the animation mods shows while generating: cycling
+// characters, colored with a gradient, followed by a label and an ellipsis.
+package anim
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/muesli/termenv"
+)
+
+const (
+	charCyclingFPS = time.Second / 22
+
+	// resolvedRune is what the cycling characters resolve to with the
+	// progress.
+	resolvedRune = '█'
+
+	// MaxChars is the largest number of cycling characters.
+	MaxChars = 120
+
+	// MinWidth is the narrowest terminal the animation fits in. Below it,
+	// only the ellipsis is shown.
+	MinWidth = 20
+)
+
+var (
+	charRunes = []rune("0123456789abcdefABCDEF~!@#$£€%^&*()+=_")
+
+	// Ellipsis is the spinner shown after the label.
+	Ellipsis = spinner.Spinner{
+		Frames: []string{"", ".", "..", "..."},
+		FPS:    time.Second / 3, //nolint:gomnd
+	}
+
+	// DefaultGradient is the gradient of the cycling characters of mods.
+	DefaultGradient = Gradient{Start: "#F967DC", End: "#6B50FF", Blend: "luv"}
+)
+
+// Styles are the styles of the animation.
+type Styles struct {
+	// CyclingChars colors the cycling characters when there's no gradient,
+	// as the terminal has no true colors.
+	CyclingChars lipgloss.Style
+	// Failed is the style of the animation once it failed.
+	Failed lipgloss.Style
+}
+
+// DefaultStyles returns the styles of the animation of mods.
+func DefaultStyles(r *lipgloss.Renderer) Styles {
+	return Styles{
+		CyclingChars: r.NewStyle().Foreground(lipgloss.Color("#FF87D7")),
+		Failed:       r.NewStyle().Foreground(lipgloss.Color("#FF5F87")).Bold(true),
+	}
+}
+
+// Gradient is a gradient between two hex colors, blended in one of Blends.
+type Gradient struct {
+	Start string
+	End   string
+	Blend string
+}
+
+// Blends are the color spaces the gradients can be blended in, by name.
+var Blends = map[string]func(colorful.Color, colorful.Color, float64) colorful.Color{
+	"luv": colorful.Color.BlendLuv,
+	"lab": colorful.Color.BlendLab,
+	"hcl": colorful.Color.BlendHcl,
+	"rgb": colorful.Color.BlendRgb,
+}
+
+// Motion is how much the animation moves.
+type Motion int
+
+const (
+	// FullMotion cycles the characters and the ellipsis.
+	FullMotion Motion = iota
+	// ReducedMotion shows the label as is, without cycling characters, and
+	// only the ellipsis moves.
+	ReducedMotion
+	// NoMotion shows the label and a full ellipsis, which never change.
+	NoMotion
+)
+
+// Option customizes the animation.
+type Option func(*Model)
+
+// WithStyles sets the styles of the animation.
+func WithStyles(s Styles) Option {
+	return func(m *Model) {
+		m.styles = s
+	}
+}
+
+// WithGradient sets the gradient of the cycling characters.
+func WithGradient(g Gradient) Option {
+	return func(m *Model) {
+		m.gradient = g
+	}
+}
+
+// WithSpinner sets the frames of the ellipsis, which are shown at the speed
+// of Ellipsis.
+func WithSpinner(frames []string) Option {
+	return func(m *Model) {
+		if len(frames) > 0 {
+			m.ellipsis.Spinner = spinner.Spinner{Frames: frames, FPS: Ellipsis.FPS}
+		}
+	}
+}
+
+// WithMotion sets how much the animation moves, for the terminals that are
+// logged or slow to redraw.
+func WithMotion(motion Motion) Option {
+	return func(m *Model) {
+		m.motion = motion
+	}
+}
+
+// WithWidth sets the width of the terminal, which the animation otherwise
+// learns from tea.WindowSizeMsg.
+func WithWidth(width int) Option {
+	return func(m *Model) {
+		m.width = width
+	}
+}
+
+type charState int
+
+const (
+	charInitialState charState = iota
+	charCyclingState
+	charEndOfLifeState
+)
+
+// cyclingChar is a single animated character.
+type cyclingChar struct {
+	finalValue   rune // if < 0 cycle forever
+	currentValue rune
+	initialDelay time.Duration
+	lifetime     time.Duration
+}
+
+func (c cyclingChar) randomRune() rune {
+	return (charRunes)[rand.Intn(len(charRunes))] //nolint:gosec
+}
+
+// state returns where the character is at: it cycles once its initial delay
+// passed, during its lifetime, then settles to its final value. The characters
+// that cycle forever never settle.
+func (c cyclingChar) state(start time.Time) charState {
+	now := time.Now()
+	if now.Before(start.Add(c.initialDelay)) {
+		return charInitialState
+	}
+	if c.finalValue > 0 && !now.Before(start.Add(c.initialDelay+c.lifetime)) {
+		return charEndOfLifeState
+	}
+	return charCyclingState
+}
+
+type stepCharsMsg struct{}
+
+// ProgressMsg tells the animation how far along the generation is, from 0 to
+// 1: that share of the cycling characters stops cycling and resolves, like a
+// progress bar. Without it, they cycle until the end.
+type ProgressMsg float64
+
+func stepChars() tea.Cmd {
+	return tea.Tick(charCyclingFPS, func(_ time.Time) tea.Msg {
+		return stepCharsMsg{}
+	})
+}
+
+// Model is the model that manages the animation that displays while the
+// output is being generated.
+type Model struct {
+	start           time.Time
+	chars           []cyclingChar
+	ramp            []lipgloss.Style
+	label           []rune
+	ellipsis        spinner.Model
+	ellipsisStarted bool
+	failed          bool
+	progress        float64
+	width           int
+	styles          Styles
+	gradient        Gradient
+	motion          Motion
+}
+
+// New returns the animation with size cycling characters, at most MaxChars,
+// followed by the label. Without options, it looks like the one of mods.
+func New(size uint, label string, r *lipgloss.Renderer, opts ...Option) Model {
+	n := int(size)
+	if n > MaxChars {
+		n = MaxChars
+	}
+
+	c := Model{
+		start:    time.Now(),
+		ellipsis: spinner.New(spinner.WithSpinner(Ellipsis)),
+		styles:   DefaultStyles(r),
+		gradient: DefaultGradient,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.motion != FullMotion {
+		// Only the label, settled from the start.
+		c.label = []rune(label)
+		c.chars = make([]cyclingChar, len(c.label))
+		for i, r := range c.label {
+			c.chars[i] = cyclingChar{finalValue: r, currentValue: r}
+		}
+		return c
+	}
+
+	gap := " "
+	if n == 0 {
+		gap = ""
+	}
+	c.label = []rune(gap + label)
+
+	// If we're in truecolor mode (and there are enough cycling characters)
+	// color the cycling characters with a gradient ramp.
+	const minRampSize = 3
+	if n >= minRampSize && r.ColorProfile() == termenv.TrueColor {
+		c.ramp = make([]lipgloss.Style, n)
+		ramp := Ramp(n, c.gradient)
+		for i, color := range ramp {
+			c.ramp[i] = r.NewStyle().Foreground(color)
+		}
+	}
+
+	makeDelay := func(a int32, b time.Duration) time.Duration {
+		return time.Duration(rand.Int31n(a)) * (time.Millisecond * b) //nolint:gosec
+	}
+
+	makeInitialDelay := func() time.Duration {
+		return makeDelay(8, 60) //nolint:gomnd
+	}
+
+	c.chars = make([]cyclingChar, n+len(c.label))
+
+	// Initial characters that cycle forever.
+	for i := 0; i < n; i++ {
+		c.chars[i] = cyclingChar{
+			finalValue:   -1, // cycle forever
+			initialDelay: makeInitialDelay(),
+		}
+	}
+
+	// Label text that only cycles for a little while.
+	for i, r := range c.label {
+		c.chars[i+n] = cyclingChar{
+			finalValue:   r,
+			initialDelay: makeInitialDelay(),
+			lifetime:     makeDelay(5, 180), //nolint:gomnd
+		}
+	}
+
+	return c
+}
+
+// Fail stops the animation, leaving the cycling characters where they were
+// followed by a "failed" label, all in the failed style.
+func (c Model) Fail() Model {
+	chars := make([]cyclingChar, 0, len(c.chars))
+	for _, char := range c.chars {
+		if char.finalValue < 0 {
+			if char.currentValue == 0 {
+				char.currentValue = '.'
+			}
+			chars = append(chars, char)
+		}
+	}
+	gap := " "
+	if len(chars) == 0 {
+		gap = ""
+	}
+	for _, r := range gap + "Failed" {
+		chars = append(chars, cyclingChar{finalValue: r, currentValue: r})
+	}
+	c.chars = chars
+	c.failed = true
+	return c
+}
+
+// Init initializes the animation.
+func (c Model) Init() tea.Cmd {
+	switch c.motion {
+	case NoMotion:
+		return nil
+	case ReducedMotion:
+		return c.ellipsis.Tick
+	default:
+		return stepChars()
+	}
+}
+
+// Update handles messages.
+func (c Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if c.failed {
+		return c, nil
+	}
+	switch msg := msg.(type) {
+	case ProgressMsg:
+		c.progress = math.Max(0, math.Min(1, float64(msg)))
+		return c, nil
+	case tea.WindowSizeMsg:
+		c.width = msg.Width
+		return c, nil
+	case stepCharsMsg:
+		resolved := int(c.progress * float64(len(c.chars)-len(c.label)))
+		for i, char := range c.chars {
+			if i < resolved {
+				c.chars[i].currentValue = resolvedRune
+				continue
+			}
+			switch char.state(c.start) {
+			case charInitialState:
+				c.chars[i].currentValue = '.'
+			case charCyclingState:
+				c.chars[i].currentValue = char.randomRune()
+			case charEndOfLifeState:
+				c.chars[i].currentValue = char.finalValue
+			}
+		}
+
+		if !c.ellipsisStarted {
+			var eol int
+			for _, char := range c.chars {
+				if char.state(c.start) == charEndOfLifeState {
+					eol++
+				}
+			}
+			if eol == len(c.label) || c.narrow() {
+				// If our entire label has reached end of life, or isn't
+				// shown, start the ellipsis "spinner" after a short pause.
+				c.ellipsisStarted = true
+				cmd = tea.Tick(time.Millisecond*220, func(_ time.Time) tea.Msg { //nolint:gomnd
+					return c.ellipsis.Tick()
+				})
+			}
+		}
+
+		return c, tea.Batch(stepChars(), cmd)
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		c.ellipsis, cmd = c.ellipsis.Update(msg)
+		return c, cmd
+	default:
+		return c, nil
+	}
+}
+
+// narrow reports whether the terminal is too narrow for more than the
+// ellipsis.
+func (c Model) narrow() bool {
+	return c.width > 0 && c.width < MinWidth
+}
+
+// View renders the animation.
+func (c Model) View() string {
+	var b strings.Builder
+	if c.narrow() && !c.failed {
+		return c.ellipsisView()
+	}
+	if c.failed {
+		for _, char := range c.chars {
+			b.WriteRune(char.currentValue)
+		}
+		return c.styles.Failed.Render(b.String())
+	}
+	for i, char := range c.chars {
+		var (
+			s *lipgloss.Style
+			r = char.currentValue
+		)
+		if len(c.ramp) > 0 && i < len(c.ramp) {
+			// There's a gradient ramp style defined for this char. Style it
+			// accordingly.
+			s = &c.ramp[i]
+		} else if char.finalValue < 0 {
+			// No gradient ramp defined, but this color will cycle forever so
+			// let's color it accordingly.
+			s = &c.styles.CyclingChars
+		}
+		if s != nil {
+			b.WriteString(s.Render(string(r)))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + c.ellipsisView()
+}
+
+// ellipsisView renders the ellipsis, at its last frame when the animation
+// doesn't move.
+func (c Model) ellipsisView() string {
+	if frames := c.ellipsis.Spinner.Frames; c.motion == NoMotion && len(frames) > 0 {
+		return frames[len(frames)-1]
+	}
+	return c.ellipsis.View()
+}
+
+// Ramp returns length colors going through the gradient. A single color, or a
+// gradient whose ends are the same, is the start color throughout.
+func Ramp(length int, g Gradient) []lipgloss.Color {
+	if length <= 0 {
+		return nil
+	}
+	var (
+		c        = make([]lipgloss.Color, length)
+		start, _ = colorful.Hex(g.Start)
+		end, _   = colorful.Hex(g.End)
+	)
+	if length == 1 || start == end {
+		for i := range c {
+			c[i] = lipgloss.Color(start.Hex())
+		}
+		return c
+	}
+	mix, ok := Blends[g.Blend]
+	if !ok {
+		mix = colorful.Color.BlendLuv
+	}
+	for i := 0; i < length; i++ {
+		// Blending in HCL can go out of the RGB gamut.
+		step := mix(start, end, float64(i)/float64(length)).Clamped()
+		c[i] = lipgloss.Color(step.Hex())
+	}
+	return c
+}
+
+// Text renders the text with the base style, going through the gradient.
+func Text(baseStyle lipgloss.Style, str string, g Gradient) string {
+	const minSize = 3
+	if len(str) < minSize {
+		return str
+	}
+	b := strings.Builder{}
+	runes := []rune(str)
+	for i, c := range Ramp(len(runes), g) {
+		b.WriteString(baseStyle.Copy().Foreground(c).Render(string(runes[i])))
+	}
+	return b.String()
+}
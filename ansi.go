@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// escapeANSI shows the control characters of the response, like the escape
+// starting an ANSI sequence, literally as \x1b, so the model can't move the
+// cursor or clear the screen. Tabs and newlines are kept.
+//
+// It works on bytes rather than runes: a chunk of the stream can end in the
+// middle of a multibyte character, which must be kept as is.
+func escapeANSI(s string) string {
+	if !hasControl(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\t', c == '\n', c == '\r':
+			b.WriteByte(c)
+		case c < 0x20, c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c == 0xc2 && i+1 < len(s) && s[i+1] >= 0x80 && s[i+1] <= 0x9f:
+			// The C1 controls, like the single character CSI U+009B.
+			fmt.Fprintf(&b, `\u%04x`, s[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeANSIChunk escapes a chunk of the stream like escapeANSI, after the
+// byte held back from the previous chunk, if any. A chunk ending in 0xc2 can
+// end in the middle of a C1 control, so that byte is held back until the
+// next chunk tells.
+func escapeANSIChunk(chunk, held string) (string, string) {
+	s := held + chunk
+	if strings.HasSuffix(s, "\xc2") {
+		return escapeANSI(s[:len(s)-1]), "\xc2"
+	}
+	return escapeANSI(s), ""
+}
+
+func hasControl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0x7f || c == 0xc2 {
+			return true
+		}
+	}
+	return false
+}
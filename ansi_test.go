@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestEscapeANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello, world", "hello, world"},
+		{"whitespace", "a\tb\r\nc\n", "a\tb\r\nc\n"},
+		{"escape", "\x1b[2Jcleared", `\x1b[2Jcleared`},
+		{"bell and delete", "ding\x07 oops\x7f", `ding\x07 oops\x7f`},
+		{"csi", "\u009b2J", `\u009b2J`},
+		{"multibyte", "héllo ¢ 世界", "héllo ¢ 世界"},
+		{"multibyte cut", "h\xc3", "h\xc3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeANSI(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeANSIChunks(t *testing.T) {
+	for _, in := range []string{
+		"move \u009b2J there",
+		"\u009b\u0090\u009d",
+		"¢ and \u009bA",
+		"\x1b[31mred\x1b[0m ¢",
+		"ends in \xc2",
+	} {
+		want := escapeANSI(in)
+		// The stream split at every offset, as two chunks.
+		for i := 0; i <= len(in); i++ {
+			a, held := escapeANSIChunk(in[:i], "")
+			b, held := escapeANSIChunk(in[i:], held)
+			if got := a + b + held; got != want {
+				t.Errorf("%q split at %d: got %q, want %q", in, i, got, want)
+			}
+		}
+	}
+}
+
+func TestEscapeANSIChunkHeld(t *testing.T) {
+	out, held := escapeANSIChunk("csi \xc2", "")
+	if out != "csi " || held != "\xc2" {
+		t.Fatalf("got %q and %q held, want %q and %q held", out, held, "csi ", "\xc2")
+	}
+	out, held = escapeANSIChunk("\x9b2J", held)
+	if out != `\u009b2J` || held != "" {
+		t.Errorf("got %q and %q held, want %q and nothing held", out, held, `\u009b2J`)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// apiKeyEnv returns the environment variable holding the key of the API:
+// the one set with api-key-env, or else the conventional one of the
+// provider, like OPENAI_API_KEY, or <NAME>_API_KEY for the others.
+func apiKeyEnv(name string, api API) string {
+	if api.APIKeyEnv != "" {
+		return api.APIKeyEnv
+	}
+	if ak, ok := apiKeys[name]; ok {
+		return ak.env
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name) + "_API_KEY"
+}
+
+// apiKey returns the key sent to the API: the api-key of its settings, or
+// else the one in its environment variable. A missing key is only an error
+// for the APIs that require one, returned as a modsError.
+func (m *Mods) apiKey(name string, api API) (string, error) {
+	if api.APIKey != "" {
+		return api.APIKey, nil
+	}
+	env := apiKeyEnv(name, api)
+	if key := os.Getenv(env); key != "" {
+		return key, nil
+	}
+	ak, ok := apiKeys[name]
+	if !ok {
+		return "", nil
+	}
+	return "", modsError{
+		reason: m.styles.inlineCode.Render(env) + " environment variabled is required.",
+		err:    withExitCode(fmt.Errorf("You can grab one at %s", m.styles.link.Render(ak.url)), exitAuth),
+	}
+}
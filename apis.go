@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// apiInfo describes a configured API for --list-apis.
+type apiInfo struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	BaseURL string      `json:"base_url"`
+	KeyEnv  string      `json:"key_env,omitempty"`
+	KeySet  *bool       `json:"key_set,omitempty"`
+	Models  []modelInfo `json:"models"`
+}
+
+type modelInfo struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// apiType returns the kind of backend mods talks to for the named API.
+func apiType(name string) string {
+	if _, ok := backends[name]; ok {
+		return name
+	}
+	return "openai-compatible"
+}
+
+func makeAPIInfos(cfg config) []apiInfo {
+	infos := make([]apiInfo, 0, len(cfg.APIs))
+	for name, api := range cfg.APIs {
+		info := apiInfo{
+			Name:    name,
+			Type:    apiType(name),
+			BaseURL: redactURL(api.BaseURL),
+			Models:  make([]modelInfo, 0, len(api.Models)),
+		}
+		if info.Type == "bedrock" {
+			info.BaseURL = bedrockBaseURL(api, awsRegion(api.Region, api.Profile))
+		}
+		if _, ok := apiKeys[name]; ok || api.APIKey != "" || api.APIKeyEnv != "" {
+			info.KeyEnv = apiKeyEnv(name, api)
+			set := api.APIKey != "" || os.Getenv(info.KeyEnv) != ""
+			info.KeySet = &set
+		}
+		for mn, m := range api.Models {
+			info.Models = append(info.Models, modelInfo{Name: mn, Aliases: m.Aliases})
+		}
+		sort.Slice(info.Models, func(i, j int) bool {
+			return info.Models[i].Name < info.Models[j].Name
+		})
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// redactURL hides any credentials embedded in the URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+func listAPIs(cfg config, s styles, asJSON bool) error {
+	infos := makeAPIInfos(cfg)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s %s\n", s.appName.Render(info.Name), s.comment.Render("("+info.Type+")"))
+		fmt.Printf("  %s %s\n", s.comment.Render("base-url:"), info.BaseURL)
+		if info.KeyEnv != "" {
+			state := "unset"
+			if *info.KeySet {
+				state = "set"
+			}
+			fmt.Printf("  %s %s %s\n", s.comment.Render("key:"), info.KeyEnv, s.comment.Render("("+state+")"))
+		}
+		models := make([]string, 0, len(info.Models))
+		for _, m := range info.Models {
+			name := m.Name
+			if len(m.Aliases) > 0 {
+				name += s.comment.Render(" (" + strings.Join(m.Aliases, ", ") + ")")
+			}
+			models = append(models, name)
+		}
+		fmt.Printf("  %s %s\n", s.comment.Render("models:"), strings.Join(models, ", "))
+	}
+	return nil
+}
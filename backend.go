@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// backend is an API that isn't OpenAI compatible, with its own requests and
+// response stream. The other APIs go through the OpenAI client.
+type backend interface {
+	// title is how the API is named in the messages, like Bedrock.
+	title() string
+	// completion sends the messages, and returns a completionStreamStart
+	// with the stream of the response, or a modsError.
+	completion(ctx context.Context, m *Mods, api API, mod Model, key string, messages []openai.ChatCompletionMessage) tea.Msg
+	// pingRequest returns the request listing the models of the API, for
+	// --ping.
+	pingRequest(ctx context.Context, cfg config, api API) (*http.Request, error)
+}
+
+// backends are the APIs with a backend of their own, by name.
+var backends = map[string]backend{
+	"bedrock": bedrockBackend{},
+	"ollama":  ollamaBackend{},
+}
+
+// bedrockBackend talks to Anthropic models on AWS Bedrock.
+type bedrockBackend struct{}
+
+func (bedrockBackend) title() string { return "Bedrock" }
+
+func (bedrockBackend) completion(ctx context.Context, m *Mods, api API, mod Model, _ string, messages []openai.ChatCompletionMessage) tea.Msg {
+	return m.bedrockCompletion(ctx, api, mod, messages)
+}
+
+func (bedrockBackend) pingRequest(ctx context.Context, cfg config, api API) (*http.Request, error) {
+	region := awsRegion(api.Region, api.Profile)
+	creds, err := loadAWSCredentials(ctx, api.Profile)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://bedrock.%s.amazonaws.com/foundation-models", region), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cfg.userAgent())
+	signAWSRequest(req, nil, creds, region, bedrockService, time.Now())
+	return req, nil
+}
+
+// backendWarning tells about the options the backend ignores, if any.
+func backendWarning(b backend, cfg config) string {
+	switch {
+	case cfg.UseTools:
+		return fmt.Sprintf("Mods doesn't call the tools through %s, --tools was ignored.", b.title())
+	case cfg.Choices > 1:
+		return fmt.Sprintf("%s sends a single response, --choices was ignored.", b.title())
+	case cfg.Web:
+		return fmt.Sprintf("%s doesn't search the web, --web was ignored.", b.title())
+	case cfg.Logprobs:
+		return fmt.Sprintf("%s doesn't send the logprobs, --logprobs was ignored.", b.title())
+	}
+	return ""
+}
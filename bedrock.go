@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	bedrockService          = "bedrock"
+	bedrockAnthropicVersion = "bedrock-2023-05-31"
+	bedrockDefaultMaxTokens = 4096
+	awsMetadataTimeout      = time.Second
+)
+
+// awsCredentials are the credentials used to sign requests to AWS.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// loadAWSCredentials looks up AWS credentials following the usual credential
+// chain: environment variables, the shared credentials and config files, and
+// finally the container or EC2 instance IAM role.
+func loadAWSCredentials(ctx context.Context, profile string) (awsCredentials, error) {
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, nil
+	}
+
+	profile = awsProfile(profile)
+	for _, f := range []struct{ path, section string }{
+		{awsSharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"), profile},
+		{awsSharedFile("AWS_CONFIG_FILE", "config"), awsConfigSection(profile)},
+	} {
+		values := readAWSIni(f.path, f.section)
+		creds = awsCredentials{
+			AccessKeyID:     values["aws_access_key_id"],
+			SecretAccessKey: values["aws_secret_access_key"],
+			SessionToken:    values["aws_session_token"],
+		}
+		if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+			return creds, nil
+		}
+	}
+
+	return awsRoleCredentials(ctx)
+}
+
+// awsRegion returns the region to use, falling back to the environment and
+// the shared config file when none is configured.
+func awsRegion(region, profile string) string {
+	if region != "" {
+		return region
+	}
+	for _, k := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(k); r != "" {
+			return r
+		}
+	}
+	path := awsSharedFile("AWS_CONFIG_FILE", "config")
+	return readAWSIni(path, awsConfigSection(awsProfile(profile)))["region"]
+}
+
+func awsProfile(profile string) string {
+	if profile != "" {
+		return profile
+	}
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
+
+func awsConfigSection(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return "profile " + profile
+}
+
+func awsSharedFile(env, name string) string {
+	if p := os.Getenv(env); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// readAWSIni returns the key/values of a section of an AWS shared ini file.
+func readAWSIni(path, section string) map[string]string {
+	values := map[string]string{}
+	if path == "" {
+		return values
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer func() { _ = f.Close() }()
+
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+// awsRoleCredentials fetches temporary credentials for the IAM role attached
+// to the ECS container or EC2 instance mods is running on.
+func awsRoleCredentials(ctx context.Context) (awsCredentials, error) {
+	var creds awsCredentials
+	client := &http.Client{Timeout: awsMetadataTimeout}
+
+	var role struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		body, err := awsMetadataGet(ctx, client, "http://169.254.170.2"+uri, "")
+		if err != nil {
+			return creds, err
+		}
+		if err := json.Unmarshal(body, &role); err != nil {
+			return creds, err
+		}
+		return awsCredentials{role.AccessKeyID, role.SecretAccessKey, role.Token}, nil
+	}
+
+	const imds = "http://169.254.169.254/latest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, imds+"/api/token", nil)
+	if err != nil {
+		return creds, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := client.Do(req)
+	if err != nil {
+		return creds, errors.New("no AWS credentials found in the environment, shared config or instance role")
+	}
+	token, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return creds, err
+	}
+
+	const path = imds + "/meta-data/iam/security-credentials/"
+	name, err := awsMetadataGet(ctx, client, path, string(token))
+	if err != nil {
+		return creds, err
+	}
+	body, err := awsMetadataGet(ctx, client, path+strings.TrimSpace(string(name)), string(token))
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal(body, &role); err != nil {
+		return creds, err
+	}
+	return awsCredentials{role.AccessKeyID, role.SecretAccessKey, role.Token}, nil
+}
+
+func awsMetadataGet(ctx context.Context, client *http.Client, url, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch instance credentials: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// signAWSRequest signs the request with AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := hexSHA256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if creds.SessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	sort.Strings(signed)
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+
+	// Path segments are encoded twice for every service but S3.
+	segments := strings.Split(req.URL.EscapedPath(), "/")
+	for i, s := range segments {
+		segments[i] = awsURIEncode(s)
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		strings.Join(segments, "/"),
+		req.URL.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID,
+		scope,
+		strings.Join(signed, ";"),
+		hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+// awsURIEncode encodes everything but the RFC 3986 unreserved characters.
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// bedrockError is an error returned by the Bedrock runtime API.
+type bedrockError struct {
+	HTTPStatusCode int
+	Type           string
+	Message        string `json:"message"`
+}
+
+func (e *bedrockError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("%s: %s", e.Type, e.Message)
+	}
+	return e.Message
+}
+
+// bedrockCompletion queries an Anthropic model on AWS Bedrock using the
+// InvokeModelWithResponseStream API.
+func (m *Mods) bedrockCompletion(ctx context.Context, api API, mod Model, messages []openai.ChatCompletionMessage) tea.Msg {
+	cfg := m.Config
+
+	creds, err := loadAWSCredentials(ctx, api.Profile)
+	if err != nil {
+		return modsError{withExitCode(err, exitAuth), "Unable to find your AWS credentials."}
+	}
+	region := awsRegion(api.Region, api.Profile)
+	if region == "" {
+		return modsError{
+			reason: "No AWS region configured.",
+			err:    withExitCode(fmt.Errorf("Please set the %s of the %s API in the settings: %s", m.styles.inlineCode.Render("region"), m.styles.inlineCode.Render(mod.API), m.styles.inlineCode.Render("mods -s")), exitConfig),
+		}
+	}
+
+	content := messages[len(messages)-1].Content
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = bedrockDefaultMaxTokens
+	}
+	// Anthropic models take the system prompt apart from the messages.
+	var system []string
+	chat := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		chat = append(chat, msg)
+	}
+	params := map[string]any{
+		"anthropic_version": bedrockAnthropicVersion,
+		"max_tokens":        maxTokens,
+		"temperature":       cfg.Temperature,
+		"top_p":             cfg.TopP,
+		"messages":          chat,
+	}
+	if len(system) > 0 {
+		params["system"] = strings.Join(system, "\n\n")
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return modsError{err, "Unable to build the Bedrock request."}
+	}
+
+	url := fmt.Sprintf("%s/model/%s/invoke-with-response-stream", bedrockBaseURL(api, region), awsURIEncode(mod.Name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return modsError{err, "Unable to build the Bedrock request."}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	req.Header.Set("User-Agent", cfg.userAgent())
+	signAWSRequest(req, body, creds, region, bedrockService, time.Now())
+
+	stream, err := newBedrockStream(req)
+	be := &bedrockError{}
+	if errors.As(err, &be) {
+		switch be.HTTPStatusCode {
+		case http.StatusNotFound:
+			return modsError{err: err, reason: fmt.Sprintf("Missing model '%s' for API '%s'", mod.Name, mod.API)}
+		case http.StatusBadRequest:
+			return modsError{err: err, reason: "Bedrock API request error."}
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return modsError{err: err, reason: "Invalid AWS credentials or missing model access."}
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return m.retry(m.lastInput, modsError{err: err, reason: "You’ve hit your Bedrock rate limit."})
+		default:
+			return m.retry(m.lastInput, modsError{err: err, reason: "Unknown Bedrock API error."})
+		}
+	}
+	if err != nil {
+		return modsError{err: err, reason: "There was a problem with the Bedrock API request."}
+	}
+	return completionStreamStart{stream: stream, prompt: content}
+}
+
+// bedrockBaseURL returns the configured base URL of the Bedrock API, or the
+// Bedrock runtime endpoint of the given region.
+func bedrockBaseURL(api API, region string) string {
+	if api.BaseURL != "" {
+		return strings.TrimSuffix(api.BaseURL, "/")
+	}
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region)
+}
+
+// bedrockStream reads the chunks of an InvokeModelWithResponseStream
+// response.
+type bedrockStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func newBedrockStream(req *http.Request) (*bedrockStream, error) {
+	resp, err := (&http.Client{Transport: baseTransport()}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		be := &bedrockError{
+			HTTPStatusCode: resp.StatusCode,
+			Type:           resp.Header.Get("X-Amzn-Errortype"),
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(body, be); err != nil || be.Message == "" {
+			be.Message = strings.TrimSpace(string(body))
+		}
+		return nil, be
+	}
+	return &bedrockStream{body: resp.Body, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+func (s *bedrockStream) Recv() (string, error) {
+	for {
+		msg, err := readEventStreamMessage(s.reader)
+		if err != nil {
+			return "", err
+		}
+		if msg.headers[":message-type"] != "event" {
+			be := &bedrockError{Type: msg.headers[":exception-type"]}
+			_ = json.Unmarshal(msg.payload, be)
+			return "", be
+		}
+		if msg.headers[":event-type"] != "chunk" {
+			continue
+		}
+		var chunk struct {
+			Bytes []byte `json:"bytes"`
+		}
+		if err := json.Unmarshal(msg.payload, &chunk); err != nil {
+			return "", err
+		}
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Text string `json:"text"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(chunk.Bytes, &event); err != nil {
+			return "", err
+		}
+		if event.Type == "content_block_delta" {
+			return event.Delta.Text, nil
+		}
+	}
+}
+
+func (s *bedrockStream) Close() {
+	_ = s.body.Close()
+}
+
+// eventStreamMessage is a message of the AWS event stream encoding.
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readEventStreamMessage reads the next message of an AWS event stream.
+// Only string headers are decoded, the others are skipped.
+func readEventStreamMessage(r io.Reader) (eventStreamMessage, error) {
+	const preludeLen, crcLen = 8, 4
+	var msg eventStreamMessage
+
+	prelude := make([]byte, preludeLen+crcLen)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		return msg, err
+	}
+	if crc32.ChecksumIEEE(prelude[:preludeLen]) != binary.BigEndian.Uint32(prelude[preludeLen:]) {
+		return msg, errors.New("event stream prelude checksum mismatch")
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if total < uint32(len(prelude))+headersLen+crcLen {
+		return msg, errors.New("invalid event stream message length")
+	}
+
+	rest := make([]byte, total-uint32(len(prelude)))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return msg, err
+	}
+	data := rest[:len(rest)-crcLen]
+	crc := crc32.Update(crc32.ChecksumIEEE(prelude), crc32.IEEETable, data)
+	if crc != binary.BigEndian.Uint32(rest[len(rest)-crcLen:]) {
+		return msg, errors.New("event stream message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(data[:headersLen])
+	if err != nil {
+		return msg, err
+	}
+	msg.headers = headers
+	msg.payload = data[headersLen:]
+	return msg, nil
+}
+
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	// Sizes of the fixed length header value types, indexed by type.
+	fixed := map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 8: 8, 9: 16}
+	errInvalid := errors.New("invalid event stream headers")
+
+	headers := map[string]string{}
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+1 {
+			return nil, errInvalid
+		}
+		name := string(b[1 : 1+n])
+		typ := b[1+n]
+		b = b[2+n:]
+		if size, ok := fixed[typ]; ok {
+			if len(b) < size {
+				return nil, errInvalid
+			}
+			b = b[size:]
+			continue
+		}
+		// Variable length byte array (6) and string (7) values.
+		if len(b) < 2 {
+			return nil, errInvalid
+		}
+		size := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+size {
+			return nil, errInvalid
+		}
+		if typ == 7 { //nolint:gomnd
+			headers[name] = string(b[2 : 2+size])
+		}
+		b = b[2+size:]
+	}
+	return headers, nil
+}
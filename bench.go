@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const defaultBenchPrompt = "Write a short paragraph about the history of the Unix pipe."
+
+// benchRun is the timing of one of the requests sent by --bench.
+type benchRun struct {
+	firstToken time.Duration
+	total      time.Duration
+	tokens     int
+	chunks     int
+	err        error
+}
+
+// tokensPerSecond returns the speed at which the response was generated,
+// from its first token if it was streamed.
+func (r benchRun) tokensPerSecond() float64 {
+	d := r.total - r.firstToken
+	if r.chunks <= 1 || d <= 0 {
+		d = r.total
+	}
+	return float64(r.tokens) / d.Seconds()
+}
+
+// benchOutput is a tea.Msg that wraps the timings of all the runs.
+type benchOutput struct {
+	model string
+	runs  []benchRun
+}
+
+// benchCmd sends the prompt --runs times, one after the other, timing each
+// response.
+func (m *Mods) benchCmd(content string) tea.Cmd {
+	return func() tea.Msg {
+		runs := make([]benchRun, 0, m.Config.BenchRuns)
+		for i := 0; i < m.Config.BenchRuns; i++ {
+			// Each run gets its own copy of the state of the request.
+			mc := *m
+			mc.cancelRequest = nil
+			mc.retries = 0
+			runs = append(runs, mc.timeCompletion(content))
+		}
+		return benchOutput{m.Config.Model, runs}
+	}
+}
+
+// timeCompletion runs the completion to its end like completeWith, timing
+// its first token and the whole response.
+func (m *Mods) timeCompletion(content string) benchRun {
+	start := time.Now()
+	for {
+		switch msg := m.startCompletionCmd(content)().(type) {
+		case completionRetry:
+			content = msg.content
+		case modsError:
+			return benchRun{err: msg}
+		case completionStreamStart:
+			var run benchRun
+			defer msg.stream.Close()
+			for {
+				chunk, err := msg.stream.Recv()
+				if errors.Is(err, io.EOF) {
+					run.total = time.Since(start)
+					run.tokens = run.chunks
+					if msg.extras != nil && msg.extras.completionTokens > 0 {
+						run.tokens = msg.extras.completionTokens
+					}
+					return run
+				}
+				if err != nil {
+					return benchRun{err: err}
+				}
+				if chunk == "" {
+					continue
+				}
+				if run.firstToken == 0 {
+					run.firstToken = time.Since(start)
+				}
+				// Without the usage reported by the API, each chunk counts as
+				// a token.
+				run.chunks++
+			}
+		default:
+			return benchRun{err: fmt.Errorf("unexpected response %T", msg)}
+		}
+	}
+}
+
+// formatBench returns a table of the minimum, median, mean and maximum of
+// the timings of the runs.
+func formatBench(out benchOutput) string {
+	var ok []benchRun
+	var failed []error
+	for _, r := range out.runs {
+		if r.err != nil {
+			failed = append(failed, r.err)
+			continue
+		}
+		ok = append(ok, r)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", out.model)
+	fmt.Fprintf(&b, "%d runs, %d failed.\n\n", len(out.runs), len(failed))
+	if len(ok) > 0 {
+		durations := func(f func(benchRun) time.Duration) []float64 {
+			vs := make([]float64, 0, len(ok))
+			for _, r := range ok {
+				vs = append(vs, f(r).Seconds()*1000) //nolint:gomnd
+			}
+			return vs
+		}
+		speeds := make([]float64, 0, len(ok))
+		for _, r := range ok {
+			speeds = append(speeds, r.tokensPerSecond())
+		}
+		b.WriteString("|  | min | median | mean | max |\n")
+		b.WriteString("|---|---:|---:|---:|---:|\n")
+		benchRow(&b, "first token (ms)", durations(func(r benchRun) time.Duration { return r.firstToken }))
+		benchRow(&b, "total (ms)", durations(func(r benchRun) time.Duration { return r.total }))
+		benchRow(&b, "tokens/sec", speeds)
+	}
+	for _, err := range failed {
+		fmt.Fprintf(&b, "\nError: %s", err)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func benchRow(b *strings.Builder, name string, values []float64) {
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	median := values[len(values)/2]
+	if len(values)%2 == 0 {
+		median = (values[len(values)/2-1] + values[len(values)/2]) / 2 //nolint:gomnd
+	}
+	fmt.Fprintf(b, "| %s | %.1f | %.1f | %.1f | %.1f |\n", name, values[0], median, sum/float64(len(values)), values[len(values)-1])
+}
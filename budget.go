@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mattn/go-isatty"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// charsPerToken is the usual number of characters of a token, used to
+// estimate the tokens when there's no tokenizer, and the context window of
+// the models that only have a max-input-chars.
+const charsPerToken = 4
+
+// showsBudget returns whether the meter of --show-budget is shown: only on
+// the terminal, not when the output is piped.
+func (c config) showsBudget() bool {
+	return c.ShowBudget && !c.Quiet && isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd())
+}
+
+// contextWindow returns the number of tokens the model takes, its
+// context-window or else what max-input-chars allows, or 0 if unknown.
+func (mod Model) contextWindow() int {
+	if mod.ContextWindow > 0 {
+		return mod.ContextWindow
+	}
+	return mod.MaxChars / charsPerToken
+}
+
+// budgetMeter returns the tokens of the messages sent, out of the context
+// window of the model, colored as it fills up. They're marked as estimated
+// when the tokenizer isn't the one of the model.
+func (m *Mods) budgetMeter(messages []openai.ChatCompletionMessage, mod Model) string {
+	tokens, exact := countMessageTokens(mod.Name, messages)
+	approx := "~"
+	if exact {
+		approx = ""
+	}
+	window := mod.contextWindow()
+	if window <= 0 {
+		return m.styles.comment.Render(fmt.Sprintf("[prompt: %s%s tokens]", approx, groupDigits(tokens)))
+	}
+	meter := fmt.Sprintf("[prompt: %s%s / %s tokens]", approx, groupDigits(tokens), groupDigits(window))
+	switch used := float64(tokens) / float64(window); {
+	case used >= 0.9: //nolint:gomnd
+		return m.styles.failed.Render(meter)
+	case used >= 0.7: //nolint:gomnd
+		return m.styles.truncated.Render(meter)
+	}
+	return m.styles.comment.Render(meter)
+}
+
+// groupDigits writes the number with commas between the thousands.
+func groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
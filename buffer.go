@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// defaultMaxBufferBytes is how much of the response can be received ahead of
+// what's written by default.
+const defaultMaxBufferBytes = 64 << 20
+
+// aheadBytes returns how much of the response was received but isn't written
+// yet by a writer taking it as it comes: the named pipe of --fifo, and the
+// terminal when the response is revealed or appended. The stream is only read
+// once the previous chunk is handled, so that's the memory held on to for a
+// slow writer. A response printed in one go at the end isn't waiting on
+// anything, and isn't counted.
+func (m *Mods) aheadBytes() int64 {
+	var n int64
+	switch {
+	case m.revealing:
+		// Counted like revealView does, on the answer without the thinking.
+		_, answer := splitThinking(m.Output)
+		n = int64(len(answer) - len(revealedWords(answer, m.revealed)))
+	case m.Config.progressive() == progressiveAppend:
+		n = int64(len(m.appendedRest()))
+	}
+	if m.fifo != nil {
+		if b := m.fifo.buffered(); b > n {
+			n = b
+		}
+	}
+	return n
+}
+
+// bufferError is the error of a response received faster than it's written,
+// past --max-buffer-bytes.
+func (m *Mods) bufferError() modsError {
+	return modsError{
+		reason: "The response is coming in faster than it can be written.",
+		err: fmt.Errorf(
+			"more than %d bytes of the response are waiting to be written, raise %s or set it to 0 for no limit",
+			m.Config.MaxBufferBytes,
+			m.styles.inlineCode.Render("--max-buffer-bytes"),
+		),
+	}
+}
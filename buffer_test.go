@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestAheadBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Mods
+		want int64
+	}{
+		{
+			name: "printed at the end",
+			m:    Mods{Output: "the whole response"},
+			want: 0,
+		},
+		{
+			name: "revealed",
+			m:    Mods{Output: "one two three", revealing: true, revealed: 1},
+			want: int64(len(" two three")),
+		},
+		{
+			name: "revealed with thinking",
+			m:    Mods{Output: "<think>a long line of thought</think>one two three", revealing: true, revealed: 2},
+			want: int64(len(" three")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.aheadBytes(); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
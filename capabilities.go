@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	capabilitiesTTL     = 24 * time.Hour
+	capabilitiesTimeout = 5 * time.Second
+)
+
+// Capabilities of the models.
+const (
+	capLogprobs = "logprobs"
+	capTools    = "tools"
+	capVision   = "vision"
+	capJSON     = "json"
+)
+
+// capabilitiesCache holds the capabilities of the models of each API, as
+// read from their model listing.
+type capabilitiesCache map[string]struct {
+	FetchedAt time.Time           `json:"fetched_at"`
+	Models    map[string][]string `json:"models"`
+}
+
+func capabilitiesPath() (string, error) {
+	return xdg.CacheFile(filepath.Join("mods", "capabilities.json"))
+}
+
+// modelCapabilities returns the capabilities of the model: the ones listed in
+// the settings, or else the ones the API reports. It returns nil when they're
+// unknown.
+func modelCapabilities(ctx context.Context, cfg config, api API, mod Model, key string) []string {
+	if len(mod.Capabilities) > 0 {
+		return mod.Capabilities
+	}
+	path, err := capabilitiesPath()
+	if err != nil {
+		return nil
+	}
+	cache := capabilitiesCache{}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &cache)
+	}
+	entry, ok := cache[mod.API]
+	if !ok || time.Since(entry.FetchedAt) > capabilitiesTTL {
+		models, err := fetchCapabilities(ctx, cfg, api, key)
+		if err != nil {
+			// Try again next time, the models listing may be temporarily
+			// unavailable.
+			return nil
+		}
+		entry.FetchedAt = time.Now()
+		entry.Models = models
+		cache[mod.API] = entry
+		if b, err := json.Marshal(cache); err == nil {
+			_ = os.WriteFile(path, b, 0o600) //nolint:gomnd
+		}
+	}
+	return entry.Models[mod.Name]
+}
+
+// fetchCapabilities reads the capabilities of the models from the model
+// listing of the API. The OpenAI listing has none, but OpenRouter and some
+// local servers describe what their models support, in different ways.
+func fetchCapabilities(ctx context.Context, cfg config, api API, key string) (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, capabilitiesTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(api.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	req.Header.Set("User-Agent", cfg.userAgent())
+	resp, err := (&http.Client{Transport: baseTransport()}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var listing struct {
+		Data []struct {
+			ID                  string   `json:"id"`
+			Capabilities        []string `json:"capabilities"`
+			SupportedParameters []string `json:"supported_parameters"`
+			Architecture        struct {
+				InputModalities []string `json:"input_modalities"`
+			} `json:"architecture"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, err
+	}
+	models := map[string][]string{}
+	for _, m := range listing.Data {
+		if len(m.Capabilities) == 0 && len(m.SupportedParameters) == 0 && len(m.Architecture.InputModalities) == 0 {
+			// Nothing is known about the model.
+			continue
+		}
+		caps := map[string]bool{}
+		for _, c := range m.Capabilities {
+			caps[strings.ToLower(c)] = true
+		}
+		for _, p := range m.SupportedParameters {
+			switch p {
+			case "logprobs", "top_logprobs":
+				caps[capLogprobs] = true
+			case "tools", "tool_choice":
+				caps[capTools] = true
+			case "response_format", "structured_outputs":
+				caps[capJSON] = true
+			}
+		}
+		for _, mod := range m.Architecture.InputModalities {
+			if mod == "image" {
+				caps[capVision] = true
+			}
+		}
+		list := make([]string, 0, len(caps))
+		for c := range caps {
+			list = append(list, c)
+		}
+		models[m.ID] = list
+	}
+	return models, nil
+}
+
+// hasCapability returns false if the capabilities are known and don't
+// include c.
+func hasCapability(caps []string, c string) bool {
+	if caps == nil {
+		return true
+	}
+	for _, have := range caps {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
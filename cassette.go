@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Environment variables recording the HTTP exchanges of mods to a directory,
+// or serving them back from it, so tests can run offline.
+const (
+	recordEnv = "MODS_RECORD"
+	replayEnv = "MODS_REPLAY"
+)
+
+// baseTransport returns the http.RoundTripper all the requests go through:
+// the default one, or one recording or replaying the exchanges if
+// MODS_RECORD or MODS_REPLAY are set.
+func baseTransport() http.RoundTripper {
+	if dir := os.Getenv(replayEnv); dir != "" {
+		return replayTransport{dir}
+	}
+	if dir := os.Getenv(recordEnv); dir != "" {
+		return recordTransport{dir, http.DefaultTransport}
+	}
+	return http.DefaultTransport
+}
+
+// cassette is a recorded HTTP exchange. Request headers aren't kept, so
+// credentials never end up in the recordings.
+type cassette struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+		Body   string `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body"`
+	} `json:"response"`
+}
+
+// cassettePath returns the file of the exchange, named after its method, URL
+// and body so the same request always maps to the same recording.
+func cassettePath(dir string, req *http.Request) (string, []byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL)
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))[:16]+".json"), body, nil
+}
+
+// recordTransport is a http.RoundTripper that saves each exchange to a
+// cassette once its response was read.
+type recordTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, body, err := cassettePath(t.dir, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	c := &cassette{}
+	c.Request.Method = req.Method
+	c.Request.URL = req.URL.String()
+	c.Request.Body = string(body)
+	c.Response.StatusCode = resp.StatusCode
+	c.Response.Header = resp.Header
+	// The response is recorded as it's read, to keep streaming it.
+	resp.Body = &recordingBody{ReadCloser: resp.Body, path: path, cassette: c}
+	return resp, nil
+}
+
+// recordingBody writes the cassette once the whole body was read, or it was
+// closed.
+type recordingBody struct {
+	io.ReadCloser
+	path     string
+	cassette *cassette
+	buf      bytes.Buffer
+	once     sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.save()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.save()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) save() {
+	b.once.Do(func() {
+		b.cassette.Response.Body = b.buf.String()
+		data, err := json.MarshalIndent(b.cassette, "", "  ")
+		if err != nil {
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil { //nolint:gomnd
+			return
+		}
+		_ = os.WriteFile(b.path, data, 0o600) //nolint:gomnd
+	})
+}
+
+// replayTransport is a http.RoundTripper that serves the responses recorded
+// with MODS_RECORD instead of sending the requests.
+type replayTransport struct {
+	dir string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, _, err := cassettePath(t.dir, req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no recording of %s %s in %s: %w", req.Method, req.URL, t.dir, err)
+	}
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	body := []byte(c.Response.Body)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Response.StatusCode, http.StatusText(c.Response.StatusCode)),
+		StatusCode:    c.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Response.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+const chatHelp = "Commands: /save [file], /model [name], /reset, /exit"
+
+// startChat switches the program to the interactive chat mode. The prompt
+// passed as arguments, if any, is sent as the first message.
+func (m *Mods) startChat() tea.Cmd {
+	if !m.terminal {
+		return func() tea.Msg {
+			return modsError{
+				reason: "Chat mode needs a terminal.",
+				err:    fmt.Errorf("Run %s from a terminal, what's piped into it is then the first message.", m.styles.inlineCode.Render("mods --chat")),
+			}
+		}
+	}
+	m.chatInput = textinput.New()
+	m.chatInput.Prompt = m.styles.flag.Render("> ")
+	m.chatInput.Placeholder = "Send a message or type /exit to quit"
+	m.chatInput.CharLimit = 0
+	m.history = loadChatHistory()
+	cmds := []tea.Cmd{
+		tea.Println(m.styles.comment.Render(chatHelp + "\n")),
+		m.chatInput.Focus(),
+	}
+	if m.continued != nil && m.Config.ShowContext {
+		cmds = append(cmds, m.chatNotice(conversationHeader(*m.continued)))
+	}
+	switch {
+	case !isatty.IsTerminal(os.Stdin.Fd()):
+		// Sent by startPipedChat once read.
+		m.anim = m.newAnimation()
+		cmds = append(cmds, tea.Batch(readChatStdinCmd, m.anim.Init()))
+	case m.Config.Prefix != "":
+		cmds = append(cmds, m.sendChatMessage(m.Config.Prefix, ""))
+	default:
+		m.state = chatInputState
+	}
+	return tea.Sequence(cmds...)
+}
+
+// chatPipedInput is a tea.Msg that wraps what was piped into the chat, the
+// first message of the chat rather than the input of a single request.
+type chatPipedInput struct{ content string }
+
+func readChatStdinCmd() tea.Msg {
+	msg := readStdinCmd()
+	if in, ok := msg.(completionInput); ok {
+		return chatPipedInput(in)
+	}
+	return msg
+}
+
+// startPipedChat sends what was piped into the chat as the first message,
+// after the prompt passed as arguments, if any.
+func (m *Mods) startPipedChat(content string) tea.Cmd {
+	if strings.TrimSpace(content) == "" {
+		if m.Config.Prefix != "" {
+			return m.sendChatMessage(m.Config.Prefix, "")
+		}
+		m.state = chatInputState
+		return nil
+	}
+	m.Input = content
+	message := m.styles.comment.Render(pipedSummary(content))
+	if m.Config.Prefix != "" {
+		message = m.Config.Prefix + " " + message
+	}
+	return m.sendChatMessage(message, content)
+}
+
+// pipedSummary stands for the piped input in the transcript of the chat,
+// which it would otherwise flood.
+func pipedSummary(content string) string {
+	lines := strings.Count(strings.TrimRight(content, "\n"), "\n") + 1
+	if lines == 1 {
+		return "(1 line piped in)"
+	}
+	return fmt.Sprintf("(%d lines piped in)", lines)
+}
+
+// sendChatMessage prints the user message and starts its completion. The
+// content is what gets sent after the configured prefix is applied.
+func (m *Mods) sendChatMessage(message, content string) tea.Cmd {
+	m.state = completionState
+	m.anim = m.newAnimation()
+	return tea.Sequence(
+		tea.Println(m.styles.flag.Render("> ")+message),
+		tea.Batch(m.anim.Init(), m.startCompletionCmd(content)),
+	)
+}
+
+// chatOutput records a completed exchange and gives the input back to the
+// user.
+func (m *Mods) chatOutput(msg completionOutput) tea.Cmd {
+	m.messages = append(m.messages, userMessage(msg.prompt), assistantMessage(msg.content))
+	m.keepReasoning(msg.reasoning)
+	m.Output = msg.content
+	m.Citations = msg.citations
+	m.retries = 0
+	_ = saveLastResponse(msg.content, m.Config.LastResponses)
+	response := strings.TrimSpace(msg.content) + formatCitations(msg.citations)
+	if m.Config.Markdown {
+		response = styleMarkdown(m.styles, strings.TrimSpace(m.FormattedOutput()), m.Config.CodeStyle)
+	}
+	// The prompt passed as arguments, and the git context, only apply to the
+	// first message.
+	m.Config.Prefix = ""
+	m.Config.GitContext = false
+	m.state = chatInputState
+	out := tea.Println(response + "\n")
+	if m.Config.Verbose && m.Config.redacting() {
+		out = tea.Sequence(m.chatNotice(redactionsNotice(m.redactions)), out)
+	}
+	if msg.truncated {
+		out = tea.Sequence(out, m.chatNotice(streamCutNotice))
+	}
+	if msg.empty {
+		out = tea.Sequence(out, m.chatNotice(emptyResponseNotice))
+	}
+	if msg.finishReason == "length" {
+		out = tea.Sequence(out, tea.Println(m.styles.truncated.Render(maxTokensNotice)+"\n"))
+	}
+	if m.Config.Notify {
+		title, tokens := m.notificationTitle(), m.responseTokens(msg.usage.completion, msg.content)
+		return tea.Batch(out, func() tea.Msg {
+			notify(title, msg.prompt, tokens)
+			return nil
+		})
+	}
+	return out
+}
+
+// chatError prints the error and lets the user try again.
+func (m *Mods) chatError(err modsError) tea.Cmd {
+	m.Error = &err
+	view := m.ErrorView()
+	m.Error = nil
+	m.retries = 0
+	m.state = chatInputState
+	return tea.Println(view)
+}
+
+func (m *Mods) updateChatInput(msg tea.KeyMsg) tea.Cmd {
+	if m.history.searching {
+		return m.updateHistorySearch(msg)
+	}
+	//nolint:exhaustive
+	switch msg.Type {
+	case tea.KeyCtrlC, tea.KeyCtrlD:
+		return tea.Quit
+	case tea.KeyUp:
+		if s, ok := m.history.prev(m.chatInput.Value()); ok {
+			m.chatInput.SetValue(s)
+			m.chatInput.CursorEnd()
+		}
+		return nil
+	case tea.KeyDown:
+		if s, ok := m.history.next(); ok {
+			m.chatInput.SetValue(s)
+			m.chatInput.CursorEnd()
+		}
+		return nil
+	case tea.KeyCtrlR:
+		m.history.searching = true
+		m.history.query = ""
+		m.history.match = -1
+		return nil
+	case tea.KeyEnter:
+		text := strings.TrimSpace(m.chatInput.Value())
+		m.chatInput.Reset()
+		if text == "" {
+			return nil
+		}
+		m.history.add(text)
+		if strings.HasPrefix(text, "/") {
+			return m.runChatCommand(text)
+		}
+		return m.sendChatMessage(text, text)
+	}
+	var cmd tea.Cmd
+	m.chatInput, cmd = m.chatInput.Update(msg)
+	return cmd
+}
+
+func (m *Mods) runChatCommand(text string) tea.Cmd {
+	name, arg, _ := strings.Cut(text, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/exit", "/quit":
+		return tea.Quit
+	case "/reset":
+		m.messages = nil
+		m.reasoning = nil
+		m.chatID = ""
+		return m.chatNotice("Started a new conversation.")
+	case "/model":
+		if arg == "" {
+			return m.chatNotice("Using model " + m.styles.inlineCode.Render(m.Config.Model) + ".")
+		}
+		if _, ok := m.Config.Models[arg]; !ok && m.Config.API == "" {
+			return m.chatNotice("Model " + m.styles.inlineCode.Render(arg) + " is not in the settings file.")
+		}
+		m.Config.Model = arg
+		return m.chatNotice("Switched to model " + m.styles.inlineCode.Render(arg) + ".")
+	case "/save":
+		var path string
+		var err error
+		if arg == "" {
+			path, err = m.saveConversation(false)
+		} else {
+			path, err = arg, writeTranscript(arg, m.messages)
+		}
+		if err != nil {
+			return m.chatError(modsError{err, "Unable to save the conversation."})
+		}
+		return m.chatNotice("Saved the conversation to " + path + ".")
+	default:
+		return m.chatNotice("Unknown command " + m.styles.inlineCode.Render(name) + ". " + chatHelp)
+	}
+}
+
+func (m *Mods) chatNotice(s string) tea.Cmd {
+	return tea.Println(m.styles.comment.Render(s) + "\n")
+}
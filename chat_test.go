@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestChatRetryIsNotPipedInput(t *testing.T) {
+	m := &Mods{Config: config{Chat: true}, state: completionState}
+	m.Update(completionRetry{"what's new in go 1.22?"})
+	if m.Input != "" {
+		t.Errorf("got input %q, want the request sent again, not piped in", m.Input)
+	}
+	m.cancelRequest()
+}
+
+func TestPipedSummary(t *testing.T) {
+	tests := map[string]string{
+		"one line":        "(1 line piped in)",
+		"one line\n":      "(1 line piped in)",
+		"two\nlines\n":    "(2 lines piped in)",
+		"a\nb\nc\n\n\n\n": "(3 lines piped in)",
+	}
+	for in, want := range tests {
+		if got := pipedSummary(in); got != want {
+			t.Errorf("pipedSummary(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const maxChatHistory = 1000
+
+// chatHistory holds the prompts sent in chat mode, persisted across sessions,
+// and the state of browsing and searching through them.
+type chatHistory struct {
+	path    string
+	entries []string
+	pos     int
+	draft   string
+
+	searching bool
+	query     string
+	match     int
+}
+
+// loadChatHistory reads the chat history file. A missing or unreadable file
+// results in an empty history.
+func loadChatHistory() chatHistory {
+	var h chatHistory
+	path, err := xdg.DataFile(filepath.Join("mods", "chat_history"))
+	if err != nil {
+		return h
+	}
+	h.path = path
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				h.entries = append(h.entries, line)
+			}
+		}
+		_ = f.Close()
+	}
+	if len(h.entries) > maxChatHistory {
+		h.entries = h.entries[len(h.entries)-maxChatHistory:]
+	}
+	h.pos = len(h.entries)
+	return h
+}
+
+// add records a prompt and appends it to the history file.
+func (h *chatHistory) add(s string) {
+	defer func() { h.pos = len(h.entries) }()
+	if n := len(h.entries); n > 0 && h.entries[n-1] == s {
+		return
+	}
+	h.entries = append(h.entries, s)
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return
+	}
+	_, _ = f.WriteString(s + "\n")
+	_ = f.Close()
+}
+
+// prev returns the entry before the one currently shown, saving the text
+// being typed so it can be restored.
+func (h *chatHistory) prev(current string) (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	if h.pos == len(h.entries) {
+		h.draft = current
+	}
+	h.pos--
+	return h.entries[h.pos], true
+}
+
+// next returns the entry after the one currently shown, or the text that was
+// being typed once the end of the history is reached.
+func (h *chatHistory) next() (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.entries) {
+		return h.draft, true
+	}
+	return h.entries[h.pos], true
+}
+
+// find returns the index of the most recent entry at or before from that
+// contains the search query, or -1.
+func (h *chatHistory) find(from int) int {
+	for i := from; i >= 0 && i < len(h.entries); i-- {
+		if strings.Contains(h.entries[i], h.query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *chatHistory) matched() string {
+	if h.match < 0 || h.match >= len(h.entries) {
+		return ""
+	}
+	return h.entries[h.match]
+}
+
+// updateHistorySearch handles keys during a reverse search of the history.
+func (m *Mods) updateHistorySearch(msg tea.KeyMsg) tea.Cmd {
+	h := &m.history
+	//nolint:exhaustive
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlG:
+		h.searching = false
+		return nil
+	case tea.KeyCtrlR:
+		if i := h.find(h.match - 1); i >= 0 {
+			h.match = i
+		}
+		return nil
+	case tea.KeyBackspace:
+		if h.query != "" {
+			r := []rune(h.query)
+			h.query = string(r[:len(r)-1])
+			h.match = h.find(len(h.entries) - 1)
+		}
+		return nil
+	case tea.KeyRunes, tea.KeySpace:
+		h.query += string(msg.Runes)
+		h.match = h.find(len(h.entries) - 1)
+		return nil
+	}
+
+	// Any other key accepts the match.
+	h.searching = false
+	if s := h.matched(); s != "" {
+		m.chatInput.SetValue(s)
+		m.chatInput.CursorEnd()
+	}
+	if msg.Type == tea.KeyEnter {
+		return m.updateChatInput(msg)
+	}
+	return nil
+}
+
+func (m *Mods) historySearchView() string {
+	return m.styles.comment.Render("(reverse-i-search)`"+m.history.query+"': ") + m.history.matched()
+}
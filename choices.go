@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// choicePreviewLines is how much of the highlighted response is shown while
+// choosing.
+const choicePreviewLines = 12
+
+// choosing is the state of the selection of one of the responses of
+// --choices.
+type choosing struct {
+	out    completionOutput
+	cursor int
+}
+
+// startChoosing lets the user pick one of the responses on a terminal, the
+// one saved to the conversation. Otherwise, and with --raw, they're all
+// printed numbered, and the first one is saved.
+func (m *Mods) startChoosing(out completionOutput) tea.Cmd {
+	if !m.Config.Raw && m.terminal && isatty.IsTerminal(os.Stdout.Fd()) {
+		m.choosing = &choosing{out: out}
+		m.state = choosingState
+		return nil
+	}
+	m.Output = formatChoices(m.choices)
+	return m.finishCompletion(out)
+}
+
+// updateChoosing handles the keys pressed while choosing.
+func (m *Mods) updateChoosing(msg tea.KeyMsg) tea.Cmd {
+	c := m.choosing
+	switch msg.String() {
+	case "ctrl+c", "esc", "q":
+		m.aborted = true
+		return tea.Quit
+	case "up", "k":
+		if c.cursor > 0 {
+			c.cursor--
+		}
+	case "down", "j":
+		if c.cursor < len(m.choices)-1 {
+			c.cursor++
+		}
+	case "enter":
+		_, c.out.content = splitThinking(m.choices[c.cursor])
+		m.Output = c.out.content
+		m.state = completionState
+		return m.finishCompletion(c.out)
+	default:
+		if k := msg.String(); len(k) == 1 && k[0] >= '1' && int(k[0]-'0') <= len(m.choices) {
+			c.cursor = int(k[0]-'0') - 1
+		}
+	}
+	return nil
+}
+
+// choosingView shows the first line of each response, and the beginning of
+// the highlighted one.
+func (m *Mods) choosingView() string {
+	var b strings.Builder
+	b.WriteString("\nWhich response do you want to keep?\n\n")
+	for i, choice := range m.choices {
+		line := fmt.Sprintf("%d. %s", i+1, firstLine(choice))
+		if m.width > 4 && len([]rune(line)) > m.width-4 { //nolint:gomnd
+			line = string([]rune(line)[:m.width-5]) + "…"
+		}
+		if i == m.choosing.cursor {
+			b.WriteString(m.styles.flag.Render("> "+line) + "\n")
+			continue
+		}
+		b.WriteString("  " + line + "\n")
+	}
+	lines := strings.Split(strings.TrimSpace(m.choices[m.choosing.cursor]), "\n")
+	if len(lines) > choicePreviewLines {
+		lines = append(lines[:choicePreviewLines], "…")
+	}
+	b.WriteString("\n" + strings.Join(lines, "\n") + "\n")
+	b.WriteString("\n" + m.styles.comment.Render("↑/↓ or 1-9 to choose, enter to keep, esc to quit") + "\n")
+	return b.String()
+}
+
+// formatChoices numbers the responses of --choices, one after the other.
+func formatChoices(choices []string) string {
+	var b strings.Builder
+	for i, choice := range choices {
+		_, answer := splitThinking(choice)
+		fmt.Fprintf(&b, "# %d\n\n%s\n\n", i+1, strings.TrimSpace(answer))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func firstLine(s string) string {
+	_, s = splitThinking(s)
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
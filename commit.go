@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const simpleCommitRole = `You write git commit messages from the git status
+and staged changes the user gives you. Start with a short subject line in the
+imperative mood, like "Handle empty input in the parser", of at most %d
+characters, followed by a blank line and a short body explaining what changed
+and why if it isn't obvious. Reply with the commit message only, without code
+blocks or any other text.`
+
+// commitRoleFor returns the instructions for --commit, in the given style.
+func commitRoleFor(style string, subjectLength int) string {
+	if style == "simple" {
+		return fmt.Sprintf(simpleCommitRole, subjectLength)
+	}
+	return strings.Replace(commitRole, "at most 72", fmt.Sprintf("at most %d", subjectLength), 1)
+}
+
+// commitMessage cleans up the generated commit message: it drops the code
+// block models tend to wrap it in and cuts the subject line down to at most
+// subjectLength characters, on a word boundary where possible.
+func commitMessage(text string, subjectLength int) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimSpace(extractCode(text))
+	}
+	subject, body, _ := strings.Cut(text, "\n")
+	subject = strings.TrimSpace(subject)
+	if subjectLength > 0 && utf8.RuneCountInString(subject) > subjectLength {
+		subject = cutSubject(subject, subjectLength)
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return subject
+	}
+	return subject + "\n\n" + body
+}
+
+func cutSubject(subject string, n int) string {
+	r := []rune(subject)
+	cut := string(r[:n])
+	if r[n] != ' ' {
+		if i := strings.LastIndex(cut, " "); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, " .,;:")
+}
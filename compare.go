@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// variant is one of the variations of the request sent by --compare and
+// --temp-sweep.
+type variant struct {
+	label string
+	apply func(*config)
+}
+
+// compareVariants returns a variant for each model given to --compare.
+func (c config) compareVariants() []variant {
+	variants := make([]variant, 0, len(c.Compare))
+	for _, model := range c.Compare {
+		model := model
+		variants = append(variants, variant{model, func(c *config) { c.Model = model }})
+	}
+	return variants
+}
+
+// tempSweepVariants returns a variant for each temperature given to
+// --temp-sweep.
+func (c config) tempSweepVariants() []variant {
+	variants := make([]variant, 0, len(c.TempSweep))
+	for _, temp := range c.TempSweep {
+		temp := temp
+		label := "temp " + strconv.FormatFloat(float64(temp), 'f', -1, 32)
+		variants = append(variants, variant{label, func(c *config) { c.Temperature = temp }})
+	}
+	return variants
+}
+
+// Brainstorming spreads the temperatures of the responses evenly over this
+// range.
+const (
+	brainstormMinTemp = 0.4
+	brainstormMaxTemp = 1.6
+)
+
+// brainstormVariants returns the numbered variants of --brainstorm, at
+// escalating temperatures.
+func (c config) brainstormVariants() []variant {
+	variants := make([]variant, 0, c.Brainstorm)
+	for i := 0; i < c.Brainstorm; i++ {
+		temp := float32((brainstormMinTemp + brainstormMaxTemp) / 2) //nolint:gomnd
+		if c.Brainstorm > 1 {
+			temp = float32(brainstormMinTemp + (brainstormMaxTemp-brainstormMinTemp)*float64(i)/float64(c.Brainstorm-1))
+		}
+		label := fmt.Sprintf("%d (temp %s)", i+1, strconv.FormatFloat(float64(temp), 'f', 2, 32))
+		variants = append(variants, variant{label, func(c *config) { c.Temperature = temp }})
+	}
+	return variants
+}
+
+// compareResult is the response to one of the variants.
+type compareResult struct {
+	label   string
+	content string
+	usage   tokenUsage
+	err     error
+}
+
+// compareOutput is a tea.Msg that wraps the responses to all the variants.
+type compareOutput struct {
+	results []compareResult
+	diff    bool
+}
+
+// compareCmd sends the same prompt with each of the variants at the same
+// time. With diff set, the responses are compared to the first one.
+func (m *Mods) compareCmd(content string, variants []variant, diff bool) tea.Cmd {
+	return func() tea.Msg {
+		results := make([]compareResult, len(variants))
+		var wg sync.WaitGroup
+		for i, v := range variants {
+			wg.Add(1)
+			go func(i int, v variant) {
+				defer wg.Done()
+				// Each variant gets its own copy of the state of the request.
+				mc := *m
+				v.apply(&mc.Config)
+				mc.cancelRequest = nil
+				mc.retries = 0
+				results[i] = mc.completeWith(v.label, content)
+			}(i, v)
+		}
+		wg.Wait()
+		return compareOutput{results, diff}
+	}
+}
+
+// completeWith runs the completion to its end, retrying like the regular
+// request does.
+func (m *Mods) completeWith(label, content string) compareResult {
+	for {
+		switch msg := m.startCompletionCmd(content)().(type) {
+		case completionRetry:
+			content = msg.content
+		case modsError:
+			return compareResult{label: label, err: msg}
+		case completionStreamStart:
+			var b strings.Builder
+			defer msg.stream.Close()
+			for {
+				chunk, err := msg.stream.Recv()
+				if errors.Is(err, io.EOF) {
+					r := compareResult{label: label, content: b.String()}
+					if msg.extras != nil {
+						r.usage = tokenUsage{msg.extras.promptTokens, msg.extras.completionTokens}
+					}
+					return r
+				}
+				if err != nil {
+					return compareResult{label: label, err: err}
+				}
+				b.WriteString(chunk)
+			}
+		default:
+			return compareResult{label: label, err: fmt.Errorf("unexpected response %T", msg)}
+		}
+	}
+}
+
+// formatComparison returns the responses to each variant under a header,
+// followed by their differences with the first response if diff is set.
+func formatComparison(results []compareResult, diff bool) string {
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "# %s\n\n", r.label)
+		if r.err != nil {
+			fmt.Fprintf(&b, "Error: %s\n\n", r.err)
+			continue
+		}
+		b.WriteString(strings.TrimSpace(r.content) + "\n\n")
+	}
+	if !diff {
+		return strings.TrimSpace(b.String())
+	}
+	first := results[0]
+	for _, r := range results[1:] {
+		if first.err != nil || r.err != nil {
+			continue
+		}
+		ud, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(strings.TrimSpace(first.content)),
+			B:        difflib.SplitLines(strings.TrimSpace(r.content)),
+			FromFile: first.label,
+			ToFile:   r.label,
+			Context:  3, //nolint:gomnd
+		})
+		fmt.Fprintf(&b, "# Diff %s %s\n\n", first.label, r.label)
+		if ud == "" {
+			b.WriteString("The responses are the same.\n\n")
+			continue
+		}
+		fmt.Fprintf(&b, "```diff\n%s```\n\n", ud)
+	}
+	return strings.TrimSpace(b.String())
+}
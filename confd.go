@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// settingsDirFiles returns the files of the mods.d directory next to the
+// settings file, sorted by name.
+func settingsDirFiles(settingsPath string) ([]string, error) {
+	dir := filepath.Join(filepath.Dir(settingsPath), "mods.d")
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// mergeSettingsDir merges the files of the mods.d directory into the content
+// of the settings file, in order, and returns the result with the files
+// merged. A file overrides the settings of the ones before, mappings like
+// apis being merged key by key, while lists are replaced as a whole.
+func mergeSettingsDir(content []byte, settingsPath string) ([]byte, []string, error) {
+	files, err := settingsDirFiles(settingsPath)
+	if err != nil || len(files) == 0 {
+		return content, nil, err
+	}
+	var merged yaml.Node
+	if err := yaml.Unmarshal(content, &merged); err != nil {
+		// Reported when the settings file is parsed.
+		return content, nil, nil //nolint:nilerr
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(doc.Content) == 0 {
+			// Empty, or only comments.
+			continue
+		}
+		if len(merged.Content) == 0 {
+			merged = doc
+			continue
+		}
+		mergeYAML(merged.Content[0], doc.Content[0])
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	if err := enc.Encode(&merged); err != nil {
+		return nil, nil, err
+	}
+	return b.Bytes(), files, enc.Close()
+}
+
+// mergeYAML merges src into dst: the keys of mappings are merged one by one,
+// anything else in src replaces what's in dst.
+func mergeYAML(dst, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				mergeYAML(dst.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
@@ -1,16 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/adrg/xdg"
+	chromastyles "github.com/alecthomas/chroma/styles"
 	"github.com/caarlos0/env/v8"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/mods/anim"
 	"github.com/muesli/termenv"
+	openai "github.com/sashabaranov/go-openai"
 	flag "github.com/spf13/pflag"
 	"gopkg.in/yaml.v3"
 )
@@ -38,27 +50,149 @@ apis:
         aliases: ["35"]
         max-input-chars: 12250
         fallback:
+  mistral:
+    base-url: https://api.mistral.ai/v1
+    # Mistral specific settings: set safe-prompt to inject Mistral's safety
+    # prompt, and random-seed to make results deterministic.
+    safe-prompt: false
+    # random-seed: 42
+    models:
+      mistral-large-latest:
+        aliases: ["mistral-large"]
+        max-input-chars: 98000
+        fallback: mistral-small-latest
+      mistral-small-latest:
+        aliases: ["mistral-small"]
+        max-input-chars: 98000
+        fallback: open-mistral-7b
+      open-mistral-7b:
+        aliases: ["mistral-7b"]
+        max-input-chars: 98000
+        fallback:
+  groq:
+    base-url: https://api.groq.com/openai/v1
+    models:
+      llama-3.1-70b-versatile:
+        aliases: ["llama-70b"]
+        max-input-chars: 392000
+        fallback: llama-3.1-8b-instant
+      llama-3.1-8b-instant:
+        aliases: ["llama-8b"]
+        max-input-chars: 392000
+        fallback:
+      mixtral-8x7b-32768:
+        aliases: ["mixtral"]
+        max-input-chars: 98000
+        fallback:
+  perplexity:
+    base-url: https://api.perplexity.ai
+    models:
+      llama-3.1-sonar-large-128k-online:
+        aliases: ["pplx", "sonar-large"]
+        max-input-chars: 381000
+        fallback: llama-3.1-sonar-small-128k-online
+      llama-3.1-sonar-small-128k-online:
+        aliases: ["sonar-small"]
+        max-input-chars: 381000
+        fallback:
+  bedrock:
+    # Requests are signed with the AWS credentials found in the environment,
+    # the shared config files or the instance IAM role.
+    region: us-east-1
+    # profile: default
+    models:
+      "anthropic.claude-3-5-sonnet-20240620-v1:0":
+        aliases: ["bedrock-sonnet"]
+        max-input-chars: 392000
+        fallback: "anthropic.claude-3-haiku-20240307-v1:0"
+      "anthropic.claude-3-haiku-20240307-v1:0":
+        aliases: ["bedrock-haiku"]
+        max-input-chars: 392000
+        fallback:
   localai:
     base-url: http://localhost:8080
+    # Pace the requests made to an API with requests-per-minute.
+    # requests-per-minute: 60
+    # Set stream to false if the server doesn't support streaming responses.
+    # stream: false
     models:
       ggml-gpt4all-j:
         aliases: ["local", "4all"]
         max-input-chars: 12250
         fallback:
+  ollama:
+    # The Ollama server, queried with its native /api/chat, no key needed.
+    base-url: http://localhost:11434
+    models:
+      llama3.1:
+        aliases: ["ollama"]
+        max-input-chars: 500000
+        fallback:
+  llamacpp:
+    # The OpenAI compatible endpoint of the llama.cpp server, started with
+    # --port 8081 not to take the port of LocalAI. It answers with the model
+    # it was started with.
+    base-url: http://localhost:8081/v1
+    models:
+      default:
+        aliases: ["llamacpp"]
+        max-input-chars: 12250
+        fallback:
 # {{ index .Help "model" }}
 default-model: gpt-4
+# {{ index .Help "model-aliases" }}
+# model-aliases:
+#   4o: gpt-4o-2024-08-06
+# {{ index .Help "model-roles" }}
+# model-roles:
+#   ggml-gpt4all-j: explain
+# {{ index .Help "role-outputs" }}
+# role-outputs:
+#   commit: clipboard
+#   explain: ~/notes/{{ "{{.Today}}" }}.md
+# {{ index .Help "roles" }}
+# roles:
+#   k8s:
+#     system: You're a Kubernetes expert. Reply with the YAML manifests only.
+#     prompt: "{{ "{{.Args}}" }}\n\nThe current manifest:\n\n{{ "{{.Input}}" }}"
+#     model: gpt-4o
+#     temp: 0.2
+#     format: false
+#     output: ~/k8s/{{ "{{.Today}}" }}.yaml
+# {{ index .Help "default-api" }}
+# default-api: openai
 # {{ index .Help "max-input-chars" }}
 max-input-chars: 12250
+# {{ index .Help "max-input-bytes" }}
+max-input-bytes: 0
+# {{ index .Help "max-buffer-bytes" }}
+max-buffer-bytes: 67108864
 # {{ index .Help "format" }}
 format: false
 # {{ index .Help "quiet" }}
 quiet: false
+# {{ index .Help "progressive" }}
+progressive: false
+# {{ index .Help "redraw-on-resize" }}
+redraw-on-resize: true
+# {{ index .Help "keepalive-interval" }}
+# keepalive-interval: 10s
 # {{ index .Help "temp" }}
 temp: 1.0
 # {{ index .Help "topp" }}
 topp: 1.0
+# {{ index .Help "presence-penalty" }}
+presence-penalty: 0.0
+# {{ index .Help "frequency-penalty" }}
+frequency-penalty: 0.0
+# {{ index .Help "user-id" }}
+# user-id: machine
 # {{ index .Help "no-limit" }}
 no-limit: false
+# {{ index .Help "max-input-tokens" }}
+max-input-tokens: 0
+# {{ index .Help "truncate" }}
+truncate: head
 # {{ index .Help "prompt-args" }}
 include-prompt-args: false
 # {{ index .Help "prompt" }}
@@ -67,34 +201,293 @@ include-prompt: 0
 max-retries: 5
 # {{ index .Help "fanciness" }}
 fanciness: 10
+# {{ index .Help "animation-width" }}
+# animation-width: 40
+# {{ index .Help "no-animation" }}
+no-animation: false
+# {{ index .Help "gradient-blend" }}
+gradient-blend: luv
+# {{ index .Help "theme" }}
+# theme: charm
+# {{ index .Help "theme-file" }}
+# theme-file: ~/.config/mods/theme.json
 # {{ index .Help "status-text" }}
 status-text: Generating
+# {{ index .Help "render-math" }}
+render-math: false
+# {{ index .Help "allow-ansi" }}
+allow-ansi: false
+# {{ index .Help "compact-tables" }}
+compact-tables: false
+# {{ index .Help "stop-after-code" }}
+stop-after-code: false
+# {{ index .Help "echo" }}
+echo: false
+# {{ index .Help "show-context" }}
+show-context: false
+# {{ index .Help "tty" }}
+tty: false
+# {{ index .Help "think" }}
+think: false
+# {{ index .Help "reasoning-context" }}
+reasoning-context: false
+# {{ index .Help "compact-history" }}
+compact-history: false
+# {{ index .Help "web" }}
+web: false
+# {{ index .Help "stats" }}
+stats: false
+# {{ index .Help "show-usage" }}
+show-usage: false
+# {{ index .Help "show-budget" }}
+show-budget: false
+# {{ index .Help "trace" }}
+trace: false
+# {{ index .Help "retry-on-truncation" }}
+retry-on-truncation: false
+# {{ index .Help "retry-on-empty" }}
+retry-on-empty: false
+# {{ index .Help "retry-on-drop" }}
+retry-on-drop: false
+# {{ index .Help "line-endings" }}
+line-endings: native
+# {{ index .Help "git-diff" }}
+git-diff: true
+# {{ index .Help "commit-style" }}
+commit-style: conventional
+# {{ index .Help "commit-subject-length" }}
+commit-subject-length: 72
+# {{ index .Help "code-style" }}
+# code-style: monokai
+# {{ index .Help "pager" }}
+pager: true
+# {{ index .Help "remember" }}
+remember: true
+# {{ index .Help "history-file" }}
+# history-file: ~/.local/share/mods/history.jsonl
+# {{ index .Help "map-reduce-prompt" }}
+# map-reduce-prompt: Merge these partial summaries into one, removing repetitions.
+# {{ index .Help "auto-title" }}
+auto-title: true
+# {{ index .Help "auto-save" }}
+auto-save: true
+# {{ index .Help "max-conversations" }}
+max-conversations: 0
+# {{ index .Help "title-prompt" }}
+# title-prompt: Title this conversation in 4 words at most, in the imperative mood.
+# {{ index .Help "title-model" }}
+# title-model: gpt-3.5-turbo
+# {{ index .Help "error-format" }}
+error-format: text
+# {{ index .Help "user-agent" }}
+# user-agent: mods (team gateway)
+# {{ index .Help "speak-command" }}
+# speak-command: espeak --stdin -s 180
+# {{ index .Help "renderer" }}
+# renderer: bat --language markdown --style plain
+# {{ index .Help "system-prefix" }}
+# system-prefix: "Today's date is {{ "{{" }} .Date {{ "}}" }}."
+# {{ index .Help "system-suffix" }}
+# system-suffix: "Answer for a {{ "{{" }} .OS {{ "}}" }} user."
+# {{ index .Help "system-mode" }}
+system-mode: append
+# {{ index .Help "prompt-separator" }}
+prompt-separator: "\n\n"
+# {{ index .Help "context-file" }}
+# context-file: ~/notes/project.md
+# {{ index .Help "examples" }}
+# examples: ~/notes/examples.yaml
 # {{ index .Help "max-tokens" }}
 # max-tokens: 100
+# {{ index .Help "last-responses" }}
+last-responses: 10
+# {{ index .Help "redact-secrets" }}
+redact-secrets: false
+# {{ index .Help "redact" }}
+# redact:
+#   - "password=\\S+"
+# {{ index .Help "tools" }}
+# tools:
+#   - name: top_memory
+#     description: List the processes using the most memory.
+#     parameters:
+#       type: object
+#       properties:
+#         count: {type: integer, description: Number of processes}
+#     command: ps aux --sort=-%mem | head -n {{ "{{.count}}" }}
+# {{ index .Help "tool-sandbox" }}
+# tool-sandbox: firejail --quiet --net=none sh -c {{ "{{.Command}}" }}
 `
 
 type config struct {
-	APIs              map[string]API `yaml:"apis"`
-	Model             string         `yaml:"default-model" env:"MODEL"`
-	Markdown          bool           `yaml:"format" env:"FORMAT"`
-	Quiet             bool           `yaml:"quiet" env:"QUIET"`
-	MaxTokens         int            `yaml:"max-tokens" env:"MAX_TOKENS"`
-	MaxInputChars     int            `yaml:"max-input-chars" env:"MAX_INPUT_CHARS"`
-	Temperature       float32        `yaml:"temp" env:"TEMP"`
-	TopP              float32        `yaml:"topp" env:"TOPP"`
-	NoLimit           bool           `yaml:"no-limit" env:"NO_LIMIT"`
-	IncludePromptArgs bool           `yaml:"include-prompt-args" env:"INCLUDE_PROMPT_ARGS"`
-	IncludePrompt     int            `yaml:"include-prompt" env:"INCLUDE_PROMPT"`
-	MaxRetries        int            `yaml:"max-retries" env:"MAX_RETRIES"`
-	Fanciness         uint           `yaml:"fanciness" env:"FANCINESS"`
-	StatusText        string         `yaml:"status-text" env:"STATUS_TEXT"`
-	API               string
-	Models            map[string]Model
-	ShowHelp          bool
-	Prefix            string
-	Version           bool
-	Settings          bool
-	SettingsPath      string
+	APIs                map[string]API `yaml:"apis"`
+	Model               string         `yaml:"default-model" env:"MODEL"`
+	Markdown            bool           `yaml:"format" env:"FORMAT"`
+	Quiet               bool           `yaml:"quiet" env:"QUIET"`
+	KeepaliveInterval   time.Duration  `yaml:"keepalive-interval" env:"KEEPALIVE_INTERVAL"`
+	MaxTokens           int            `yaml:"max-tokens" env:"MAX_TOKENS"`
+	MaxInputChars       int            `yaml:"max-input-chars" env:"MAX_INPUT_CHARS"`
+	Temperature         float32        `yaml:"temp" env:"TEMP"`
+	TopP                float32        `yaml:"topp" env:"TOPP"`
+	PresencePenalty     float32        `yaml:"presence-penalty" env:"PRESENCE_PENALTY"`
+	FrequencyPenalty    float32        `yaml:"frequency-penalty" env:"FREQUENCY_PENALTY"`
+	NoLimit             bool           `yaml:"no-limit" env:"NO_LIMIT"`
+	MaxInputTokens      int            `yaml:"max-input-tokens" env:"MAX_INPUT_TOKENS"`
+	Truncate            string         `yaml:"truncate" env:"TRUNCATE"`
+	IncludePromptArgs   bool           `yaml:"include-prompt-args" env:"INCLUDE_PROMPT_ARGS"`
+	IncludePrompt       int            `yaml:"include-prompt" env:"INCLUDE_PROMPT"`
+	MaxRetries          int            `yaml:"max-retries" env:"MAX_RETRIES"`
+	Fanciness           uint           `yaml:"fanciness" env:"FANCINESS"`
+	AnimationWidth      uint           `yaml:"animation-width" env:"ANIMATION_WIDTH"`
+	NoAnimation         bool           `yaml:"no-animation" env:"NO_ANIMATION"`
+	GradientBlend       string         `yaml:"gradient-blend" env:"GRADIENT_BLEND"`
+	Theme               string         `yaml:"theme" env:"THEME"`
+	ThemeFile           string         `yaml:"theme-file" env:"THEME_FILE"`
+	theme               theme
+	StatusText          string `yaml:"status-text" env:"STATUS_TEXT"`
+	API                 string `yaml:"default-api" env:"API"`
+	SystemPrefix        string `yaml:"system-prefix" env:"SYSTEM_PREFIX"`
+	SystemSuffix        string `yaml:"system-suffix" env:"SYSTEM_SUFFIX"`
+	System              string `yaml:"system" env:"SYSTEM"`
+	SystemMode          string `yaml:"system-mode" env:"SYSTEM_MODE"`
+	PromptSeparator     string `yaml:"prompt-separator" env:"PROMPT_SEPARATOR"`
+	ShowSystem          bool
+	PrintConfig         bool
+	ShowSecrets         bool
+	PromptOnly          bool
+	ContextFile         string `yaml:"context-file" env:"CONTEXT_FILE"`
+	NoContext           bool
+	Models              map[string]Model
+	ShowHelp            bool
+	Prefix              string
+	Version             bool
+	Settings            bool
+	EditConfig          bool
+	ModelAliases        map[string]string `yaml:"model-aliases"`
+	ModelRoles          map[string]string `yaml:"model-roles"`
+	RoleOutputs         map[string]string `yaml:"role-outputs"`
+	Roles               map[string]Role   `yaml:"roles"`
+	SettingsPath        string
+	settingsNotice      string
+	settingsFiles       []string
+	ListAPIs            bool
+	ListRoles           bool
+	Ping                bool
+	SetDefaultAPI       string
+	Chat                bool
+	JSON                bool
+	OutputFormat        string
+	ANSI                bool
+	Vars                []string
+	Copy                bool
+	Notify              bool
+	LastResponses       int `yaml:"last-responses" env:"LAST_RESPONSES"`
+	Last                int
+	RedactSecrets       bool     `yaml:"redact-secrets" env:"REDACT_SECRETS"`
+	Redact              []string `yaml:"redact"`
+	Tools               []Tool   `yaml:"tools"`
+	UseTools            bool
+	Yolo                bool
+	ToolSandbox         string `yaml:"tool-sandbox" env:"TOOL_SANDBOX"`
+	Verbose             bool
+	MaxInputBytes       int64 `yaml:"max-input-bytes" env:"MAX_INPUT_BYTES"`
+	MaxBufferBytes      int64 `yaml:"max-buffer-bytes" env:"MAX_BUFFER_BYTES"`
+	Yes                 bool
+	Import              string
+	ExportAll           string
+	Pin                 string
+	Unpin               string
+	Delete              string
+	List                bool
+	Rename              string
+	Overwrite           bool
+	Since               string
+	Compare             []string
+	TempSweep           []float32
+	Brainstorm          int
+	Choices             int
+	Bench               bool
+	BenchRuns           int
+	Renderer            string `yaml:"renderer" env:"RENDERER"`
+	Logprobs            bool
+	TopLogprobs         int
+	Raw                 bool
+	RevealRate          int  `yaml:"reveal-rate" env:"REVEAL_RATE"`
+	Progressive         bool `yaml:"progressive" env:"PROGRESSIVE"`
+	RedrawOnResize      bool `yaml:"redraw-on-resize" env:"REDRAW_ON_RESIZE"`
+	Explain             bool
+	Role                string `yaml:"role" env:"ROLE"`
+	GitContext          bool
+	GitDiff             bool `yaml:"git-diff" env:"GIT_DIFF"`
+	NoGitDiff           bool
+	Commit              bool
+	CommitStyle         string `yaml:"commit-style" env:"COMMIT_STYLE"`
+	CommitSubjectLength int    `yaml:"commit-subject-length" env:"COMMIT_SUBJECT_LENGTH"`
+	Fix                 bool
+	Diagnose            bool
+	ExtractCode         bool
+	StopAfterCode       bool `yaml:"stop-after-code" env:"STOP_AFTER_CODE"`
+	Sentences           int
+	RenderMath          bool `yaml:"render-math" env:"RENDER_MATH"`
+	AllowANSI           bool `yaml:"allow-ansi" env:"ALLOW_ANSI"`
+	Steps               bool
+	NoMarkdown          bool
+	FIFO                string
+	As                  string
+	Pager               bool `yaml:"pager" env:"PAGER"`
+	NoPager             bool
+	Remember            bool   `yaml:"remember" env:"REMEMBER"`
+	HistoryFile         string `yaml:"history-file" env:"HISTORY_FILE"`
+	NoHistory           bool
+	NoRemember          bool
+	remembered          *remembered
+	rememberNotice      string
+	CompactTables       bool `yaml:"compact-tables" env:"COMPACT_TABLES"`
+	Speak               bool
+	SpeakCommand        string `yaml:"speak-command" env:"SPEAK_COMMAND"`
+	MapReduce           bool
+	MapReducePrompt     string `yaml:"map-reduce-prompt" env:"MAP_REDUCE_PROMPT"`
+	Continue            string
+	Echo                bool `yaml:"echo" env:"ECHO"`
+	PersistParams       bool
+	ContinueGeneration  string
+	Scratch             bool
+	Messages            []openai.ChatCompletionMessage
+	Examples            string `yaml:"examples" env:"EXAMPLES"`
+	ScratchReset        bool
+	ShowContext         bool `yaml:"show-context" env:"SHOW_CONTEXT"`
+	Replay              string
+	ReplayLast          bool
+	UserAgent           string `yaml:"user-agent" env:"USER_AGENT"`
+	ErrorFormat         string `yaml:"error-format" env:"ERROR_FORMAT"`
+	NoStream            bool
+	Depth               int
+	TitlePrompt         string `yaml:"title-prompt" env:"TITLE_PROMPT"`
+	TitleModel          string `yaml:"title-model" env:"TITLE_MODEL"`
+	AutoTitle           bool   `yaml:"auto-title" env:"AUTO_TITLE"`
+	NoTitle             bool
+	AutoSave            bool `yaml:"auto-save" env:"AUTO_SAVE"`
+	MaxConversations    int  `yaml:"max-conversations" env:"MAX_CONVERSATIONS"`
+	NoSave              bool
+	Title               string
+	LogitBias           []string
+	UserID              string `yaml:"user-id" env:"USER_ID"`
+	RawRequest          string
+	TTY                 bool   `yaml:"tty" env:"TTY"`
+	CodeStyle           string `yaml:"code-style" env:"CODE_STYLE"`
+	Think               bool   `yaml:"think" env:"THINK"`
+	ShowReasoning       bool
+	ReasoningContext    bool   `yaml:"reasoning-context" env:"REASONING_CONTEXT"`
+	CompactHistory      bool   `yaml:"compact-history" env:"COMPACT_HISTORY"`
+	Web                 bool   `yaml:"web" env:"WEB"`
+	Stats               bool   `yaml:"stats" env:"STATS"`
+	ShowUsage           bool   `yaml:"show-usage" env:"SHOW_USAGE"`
+	ShowBudget          bool   `yaml:"show-budget" env:"SHOW_BUDGET"`
+	Trace               bool   `yaml:"trace" env:"TRACE"`
+	RetryOnTruncation   bool   `yaml:"retry-on-truncation" env:"RETRY_ON_TRUNCATION"`
+	RetryOnEmpty        bool   `yaml:"retry-on-empty" env:"RETRY_ON_EMPTY"`
+	RetryOnDrop         bool   `yaml:"retry-on-drop" env:"RETRY_ON_DROP"`
+	LineEndings         string `yaml:"line-endings" env:"LINE_ENDINGS"`
 }
 
 func newConfig() (config, error) {
@@ -102,67 +495,217 @@ func newConfig() (config, error) {
 	var content []byte
 
 	help := map[string]string{
-		"api":             "OpenAI compatible REST API (openai, localai).",
-		"apis":            "Aliases and endpoints for OpenAI compatible REST API.",
-		"model":           "Default model (gpt-3.5-turbo, gpt-4, ggml-gpt4all-j...).",
-		"max-input-chars": "Default character limit on input to model.",
-		"format":          "Format response as markdown.",
-		"prompt":          "Include the prompt from the arguments and stdin, truncate stdin to specified number of lines.",
-		"prompt-args":     "Include the prompt from the arguments in the response.",
-		"quiet":           "Quiet mode (hide the spinner while loading).",
-		"help":            "Show help and exit.",
-		"version":         "Show version and exit.",
-		"max-retries":     "Maximum number of times to retry API calls.",
-		"no-limit":        "Turn off the client-side limit on the size of the input into the model.",
-		"max-tokens":      "Maximum number of tokens in response.",
-		"temp":            "Temperature (randomness) of results, from 0.0 to 2.0.",
-		"topp":            "TopP, an alternative to temperature that narrows response, from 0.0 to 1.0.",
-		"fanciness":       "Number of cycling characters in the 'generating' animation.",
-		"status-text":     "Text to show while generating.",
-		"settings":        "Open settings in your $EDITOR.",
+		"api":                   "API to use, overriding the API of the model (openai, mistral, groq, perplexity, bedrock, localai, ollama, llamacpp).",
+		"default-api":           "Default API to use, overriding the API of the model.",
+		"set-default-api":       "Save the API to use by default to the settings.",
+		"apis":                  "Aliases and endpoints for OpenAI compatible REST API.",
+		"model":                 "Default model (gpt-3.5-turbo, gpt-4, ggml-gpt4all-j...).",
+		"model-aliases":         "Short names for models, like 4o for gpt-4o-2024-08-06, usable wherever a model is.",
+		"model-roles":           "Role to use by default with each model, unless another role is set.",
+		"role-outputs":          "Where the responses of each built-in role go besides stdout: clipboard, or a file to append them to.",
+		"roles":                 "Roles used with --role, with their system prompt, and optionally a prompt template, model, temp and format.",
+		"list-roles":            "List the built-in roles and the roles of the settings.",
+		"max-input-chars":       "Default character limit on input to model.",
+		"format":                "Format response as markdown, print it as a JSON object with --format=full-json, or the steps of --steps as a JSON array with --format=json.",
+		"ansi":                  "Keep the styles of the rendered content of --format=full-json.",
+		"prompt":                "Include the prompt from the arguments and stdin, truncate stdin to specified number of lines.",
+		"prompt-args":           "Include the prompt from the arguments in the response.",
+		"quiet":                 "Quiet mode (hide the spinner while loading).",
+		"keepalive-interval":    "With --quiet or --no-animation, write an invisible byte to stderr this often while generating, like 10s, to keep SSH sessions alive.",
+		"help":                  "Show help and exit.",
+		"version":               "Show version and exit.",
+		"max-retries":           "Maximum number of times to retry API calls.",
+		"no-limit":              "Turn off the client-side limit on the size of the input into the model.",
+		"max-input-tokens":      "Limit the input to this many tokens, counted with the tokenizer of the model, on top of max-input-chars. 0 for no limit.",
+		"truncate":              "Part of the input kept when it's over the limit: head, tail or middle, which keeps both ends.",
+		"max-tokens":            "Maximum number of tokens in response.",
+		"temp":                  "Temperature (randomness) of results, from 0.0 to 2.0.",
+		"topp":                  "TopP, an alternative to temperature that narrows response, from 0.0 to 1.0.",
+		"presence-penalty":      "Penalty for tokens that already appeared, encouraging new topics, from -2.0 to 2.0.",
+		"frequency-penalty":     "Penalty for tokens by how often they appeared, reducing repetition, from -2.0 to 2.0.",
+		"fanciness":             "Number of cycling characters in the 'generating' animation, 0 to only animate the status text.",
+		"gradient-blend":        "Color space the gradients of the animation and the help are blended in: luv, lab, hcl or rgb.",
+		"theme":                 "Built-in theme of the animation, the help and the code blocks: charm, mono or ocean.",
+		"theme-file":            "JSON file of the theme, with its gradient, cycling_chars, spinner and code_style, on top of --theme.",
+		"animation-width":       "Number of cycling characters in the 'generating' animation, overriding fanciness, at most 120 and what fits in the terminal.",
+		"no-animation":          "Show the status text and its ellipsis without moving while generating, for logged or slow terminals.",
+		"status-text":           "Text to show while generating.",
+		"system-prefix":         "Text added at the start of the system prompt, with {{.Date}} and {{.OS}} expanded.",
+		"system-suffix":         "Text added at the end of the system prompt, with {{.Date}} and {{.OS}} expanded.",
+		"system":                "System prompt, added after the instructions of the role.",
+		"system-mode":           "Whether --system is added to the instructions of the role (append) or replaces them (replace).",
+		"prompt-separator":      "Text between the prompt given as arguments and the piped input, a blank line by default.",
+		"show-system":           "Print the system prompt that would be sent, and exit.",
+		"print-config":          "Print the settings in use, with the defaults, environment variables and flags applied, and exit.",
+		"show-secrets":          "Show the API keys in the output of --print-config.",
+		"prompt-only":           "Print the messages that would be sent, with their roles, without sending them.",
+		"context-file":          "File whose content is sent as context with every request.",
+		"no-context":            "Don't send the context file with this request.",
+		"settings":              "Open settings in your $EDITOR.",
+		"edit-config":           "Open settings in your $EDITOR and check them once saved.",
+		"list-apis":             "List the configured APIs and their models.",
+		"json":                  "Print list output as JSON.",
+		"ping":                  "Check that the APIs, or the one of --api, are reachable with their keys, and exit.",
+		"list":                  "List the saved conversations, the most recent first.",
+		"rename":                "Rename the conversation with the given ID or title to the title given as arguments.",
+		"overwrite":             "Take the title given to --rename even if another conversation has it.",
+		"since":                 "Only list the conversations updated since then, like 7d, 12h or 2024-01-01.",
+		"chat":                  "Start an interactive chat session.",
+		"var":                   "Set a variable used in prompt templates, as name=value.",
+		"copy":                  "Copy the response to the clipboard.",
+		"notify":                "Show a desktop notification once the response is ready.",
+		"last":                  "Print the last response again, or the nth last one.",
+		"last-responses":        "Number of recent responses to keep for --last.",
+		"redact-secrets":        "Replace API keys and tokens in the prompt with [REDACTED] before sending it.",
+		"redact":                "Regular expressions matching more text to redact from the prompt.",
+		"tools":                 "Let the model call the tools of the settings, each running a shell command once you confirm it.",
+		"yolo":                  "Run the commands of the tools of --tools without asking first, for trusted workflows only.",
+		"tool-sandbox":          "Command the commands of the tools run in, with the shell-quoted command as {{.Command}}, like bwrap or firejail.",
+		"verbose":               "Show more details about the request.",
+		"max-input-bytes":       "Refuse to send prompts larger than this many bytes without --yes, 0 for no limit.",
+		"yes":                   "Send the prompt even if it's over the max-input-bytes limit.",
+		"max-buffer-bytes":      "Fail when more than this many bytes of the response are waiting to be written, 0 for no limit.",
+		"import":                "Import the conversations of a ChatGPT export (conversations.json) or of a backup.",
+		"export-all":            "Back up all the conversations to a file that can be restored with --import.",
+		"pin":                   "Pin the conversation with the given ID or title, protecting it from bulk deletes.",
+		"unpin":                 "Unpin the conversation with the given ID or title.",
+		"delete":                "Delete the saved conversation with the given ID or title, even if it's pinned.",
+		"compare":               "Send the prompt to each of these models and compare the responses.",
+		"bench":                 "Send the prompt several times and report the latency of the model.",
+		"runs":                  "Number of requests sent by --bench, --n works too.",
+		"temp-sweep":            "Send the prompt with each of these temperatures and show the responses.",
+		"brainstorm":            "Show this many responses to the prompt, at escalating temperatures, and their total cost.",
+		"choices":               "Ask for this many responses in one request, the n of the API, and pick the one to keep.",
+		"renderer":              "Command to pipe the response through to render it.",
+		"logprobs":              "Show the log probabilities of the tokens of the response.",
+		"top-logprobs":          "Number of most likely alternatives to show for each token with --logprobs.",
+		"raw":                   "Print the response only, or its logprobs as JSON with --logprobs.",
+		"role":                  "Role to use: commit, diagnose, explain, fix, or one of the roles of the settings.",
+		"git-context":           "Send the git status of the current repository, and its staged changes, along with the prompt.",
+		"git-diff":              "Include the staged changes in the git context.",
+		"no-git-diff":           "Leave the staged changes out of the git context.",
+		"commit":                "Write a commit message for the staged changes, and output it only.",
+		"commit-style":          "Style of the commit messages of --commit: conventional or simple.",
+		"commit-subject-length": "Maximum length of the subject line of the commit messages of --commit.",
+		"explain":               "Explain the shell command given as the prompt.",
+		"fix":                   "Fix the failed shell command given as the prompt, using its output from stdin.",
+		"diagnose":              "Diagnose the error in the output piped in, like somecmd 2>&1 | mods --diagnose, and suggest fixes.",
+		"extract-code":          "Print only the code of the first code block of the response.",
+		"stop-after-code":       "Stop the generation once the first code block of the response is complete.",
+		"sentences":             "Print only the first N sentences of the response, as plain text.",
+		"render-math":           "Show the LaTeX math of the response as unicode, like √(x²+1) for \\sqrt{x^2+1}.",
+		"allow-ansi":            "Let the escape sequences of the response through to the terminal, instead of showing them literally.",
+		"fifo":                  "Also write the response as it's generated to this named pipe, for an editor to follow it.",
+		"no-markdown":           "Ask for a plain text response, and print it without styling.",
+		"steps":                 "Ask for the response as numbered steps, printed as a JSON array with --format=json.",
+		"as":                    "Print the response as code (its longest code block), markdown (as is), text (without the markdown) or auto (guessed from the response).",
+		"compact-tables":        "Show Markdown tables wider than the terminal as lists.",
+		"pager":                 "Open responses that don't fit in the terminal in your $PAGER.",
+		"no-pager":              "Print the response without opening it in your $PAGER.",
+		"remember":              "Use the model and role last given with --model and --role by default, when the settings don't set them.",
+		"no-remember":           "Don't use or remember the model and role of the last runs.",
+		"history-file":          "JSONL file every prompt is logged to, with its model, time and tokens.",
+		"no-history":            "Don't log the prompt to the history-file.",
+		"speak":                 "Read the response out loud once it's printed.",
+		"speak-command":         "Text to speech command reading the response from stdin for --speak (say, spd-say or espeak by default).",
+		"map-reduce":            "Split inputs too long for the model in parts, send the prompt with each and combine the responses.",
+		"map-reduce-prompt":     "Instruction sent with the responses to each part of the input to combine them with --map-reduce.",
+		"continue":              "Continue the saved conversation with the given ID or title, or the most recent one with last.",
+		"echo":                  "Print the prompt, as in the transcripts of --replay, before the response.",
+		"persist-params":        "Save the model parameters given with flags to the continued conversation, instead of using them for this run only.",
+		"continue-generation":   "Continue the last response of the saved conversation with the given ID or title, after it was cut off by --max-tokens.",
+		"user":                  "Add a user message before the prompt, for few-shot prompting. Can be repeated, and mixed with --assistant in order.",
+		"assistant":             "Add an assistant message before the prompt, for few-shot prompting. Can be repeated, and mixed with --user in order.",
+		"examples":              "YAML file of user and assistant messages added before the prompt, for few-shot prompting.",
+		"scratch":               "Continue the scratch conversation, started on first use.",
+		"scratch-reset":         "Clear the scratch conversation.",
+		"show-context":          "Show the title, model, number of turns and age of the conversation being continued.",
+		"replay":                "Show the saved conversation with the given ID or title.",
+		"replay-last":           "Show the most recently updated saved conversation.",
+		"error-format":          "Format of the errors: text, or json to print them as JSON objects on stderr.",
+		"user-agent":            "User-Agent header sent with the requests, mods/<version> by default.",
+		"no-stream":             "Wait for the whole response instead of streaming it, for servers that don't support streaming.",
+		"depth":                 "Number of times to ask the model to critique and improve its response.",
+		"title-prompt":          "Instruction used to title the saved conversations from their first message.",
+		"title-model":           "Model used to title the saved conversations, the model in use by default.",
+		"auto-title":            "Have the model title the saved conversations, or else title them with their first message.",
+		"no-title":              "Title the saved conversation with its first message instead of asking the model.",
+		"auto-save":             "Save every conversation, or else only the ones given a --title.",
+		"max-conversations":     "Maximum number of saved conversations, the least recently updated unpinned ones being deleted past it. 0 keeps them all.",
+		"no-save":               "Don't save this conversation.",
+		"title":                 "Title of the conversation, saving it even with --no-save.",
+		"logit-bias":            "Make a token more or less likely, as token:bias with a bias from -100 to 100, the token being an ID or text tokenized for the model.",
+		"user-id":               "User sent with the requests for the abuse monitoring of the provider, machine for a hash of the machine ID.",
+		"raw-request":           "Send the JSON request body of this file as is to the chat completions endpoint and print the response.",
+		"tty":                   "When the output is piped, also show the response styled on the terminal.",
+		"think":                 "Show the reasoning of the model before its answer.",
+		"show-reasoning":        "Show the reasoning behind the responses of the conversation shown with --replay.",
+		"reasoning-context":     "Send the saved reasoning back to the model when continuing a conversation.",
+		"compact-history":       "Leave the reasoning and tool messages of the earlier turns out of the continued conversation sent, keeping the answers.",
+		"web":                   "Let the provider search the web to answer, citing its sources.",
+		"stats":                 "Show the model, time, tokens and cost of the response on stderr.",
+		"show-usage":            "Show the prompt and completion tokens and their cost on stderr, counted with the tokenizer if the API doesn't report them.",
+		"trace":                 "Export OpenTelemetry spans of the run to the OTLP endpoint of the OTEL_EXPORTER_OTLP_* variables.",
+		"show-budget":           "Show the estimated tokens of the prompt, out of the context window of the model, before the response.",
+		"retry-on-truncation":   "Send the request again when the response stream is cut before its end.",
+		"retry-on-empty":        "Send the request again when the response is empty.",
+		"line-endings":          "Line endings of the raw response and the extracted code: lf, crlf or native.",
+		"retry-on-drop":         "Send the request again when the connection drops while the response is streamed.",
+		"code-style":            "Chroma style used to highlight code blocks in styled output (monokai, github, dracula...).",
+		"reveal-rate":           "Show the response as it's generated at this many words per minute, 0 to only show it once done.",
+		"progressive":           "Show the raw response as it's generated, then replace it with the styled one once done.",
+		"redraw-on-resize":      "Clear the screen to draw the response again when the terminal gets narrower while it's shown.",
 	}
 
 	sp, err := xdg.ConfigFile(filepath.Join("mods", "mods.yml"))
 	if err != nil {
-		return c, err
+		// The directory can't be created, the defaults are used below.
+		sp = filepath.Join(xdg.ConfigHome, "mods", "mods.yml")
 	}
 	c.SettingsPath = sp
 	if _, err := os.Stat(sp); os.IsNotExist(err) {
-		tmpl, err := template.New("config").Parse(strings.TrimSpace(configTemplate))
-		if err != nil {
-			return c, err
-		}
-		if err := os.MkdirAll(filepath.Dir(sp), 0o700); err != nil {
-			return c, err
-		}
-
-		f, err := os.Create(sp)
+		// First run: write the default settings, or if that fails, use them
+		// without a file.
+		content, err = defaultSettings(c, help)
 		if err != nil {
 			return c, err
 		}
-		defer func() { _ = f.Close() }()
-
-		m := struct {
-			Config config
-			Help   map[string]string
-		}{
-			Config: c,
-			Help:   help,
-		}
-		if err := tmpl.Execute(f, m); err != nil {
-			return c, err
+		if err := writeSettings(sp, content); err != nil {
+			c.settingsNotice = "Unable to write the settings file, using the defaults: " + err.Error()
+		} else {
+			c.settingsNotice = fmt.Sprintf("Wrote the default settings to %s, edit them with mods --settings.", sp)
 		}
 	} else if err != nil {
 		return c, err
-	}
-	content, err = os.ReadFile(sp)
-	if err != nil {
+	} else if content, err = os.ReadFile(sp); err != nil {
 		return c, err
 	}
-	err = yaml.Unmarshal(content, &c)
+	content, c.settingsFiles, err = mergeSettingsDir(content, sp)
 	if err != nil {
 		return c, err
 	}
+	// A broken settings file can still be fixed with --settings or
+	// --edit-config, so only fail once the flags are parsed.
+	// Defaults for the settings files created before these were added.
+	c.LastResponses = defaultLastResponses
+	c.Pager = true
+	c.MapReducePrompt = defaultMapReducePrompt
+	c.TitlePrompt = defaultTitlePrompt
+	c.AutoTitle = true
+	c.AutoSave = true
+	c.GitDiff = true
+	c.CommitStyle = "conventional"
+	c.SystemMode = "append"
+	c.PromptSeparator = "\n\n"
+	c.CommitSubjectLength = 72
+	c.LineEndings = "native"
+	c.Truncate = truncateHead
+	c.GradientBlend = "luv"
+	c.theme = defaultTheme()
+	c.Remember = true
+	c.MaxBufferBytes = defaultMaxBufferBytes
+	c.RedrawOnResize = true
+	yamlErr := yaml.Unmarshal(content, &c)
 
 	ms := make(map[string]Model)
 	for ak, av := range c.APIs {
@@ -184,36 +727,384 @@ func newConfig() (config, error) {
 
 	flag.StringVarP(&c.Model, "model", "m", c.Model, help["model"])
 	flag.StringVarP(&c.API, "api", "a", c.API, help["api"])
-	flag.BoolVarP(&c.Markdown, "format", "f", c.Markdown, help["format"])
+	flag.VarP(formatFlag{&c.Markdown, &c.OutputFormat}, "format", "f", help["format"])
+	flag.Lookup("format").NoOptDefVal = "true"
+	flag.BoolVar(&c.ANSI, "ansi", false, help["ansi"])
+	flag.StringVar(&c.Renderer, "renderer", c.Renderer, help["renderer"])
 	flag.IntVarP(&c.IncludePrompt, "prompt", "P", c.IncludePrompt, help["prompt"])
 	flag.BoolVarP(&c.IncludePromptArgs, "prompt-args", "p", c.IncludePromptArgs, help["prompt-args"])
 	flag.BoolVarP(&c.Quiet, "quiet", "q", c.Quiet, help["quiet"])
+	flag.DurationVar(&c.KeepaliveInterval, "keepalive-interval", c.KeepaliveInterval, help["keepalive-interval"])
+	flag.IntVar(&c.RevealRate, "reveal-rate", c.RevealRate, help["reveal-rate"])
+	flag.BoolVar(&c.Progressive, "progressive", c.Progressive, help["progressive"])
+	flag.BoolVar(&c.RedrawOnResize, "redraw-on-resize", c.RedrawOnResize, help["redraw-on-resize"])
+	flag.BoolVar(&c.Chat, "chat", false, help["chat"])
+	flag.BoolVar(&c.Explain, "explain", false, help["explain"])
+	flag.BoolVar(&c.Fix, "fix", false, help["fix"])
+	flag.BoolVar(&c.Diagnose, "diagnose", false, help["diagnose"])
+	flag.StringVar(&c.Role, "role", c.Role, help["role"])
+	flag.BoolVar(&c.GitContext, "git-context", false, help["git-context"])
+	flag.BoolVar(&c.NoGitDiff, "no-git-diff", false, help["no-git-diff"])
+	flag.BoolVar(&c.Commit, "commit", false, help["commit"])
+	flag.StringVar(&c.CommitStyle, "commit-style", c.CommitStyle, help["commit-style"])
+	flag.IntVar(&c.CommitSubjectLength, "commit-subject-length", c.CommitSubjectLength, help["commit-subject-length"])
+	flag.BoolVar(&c.ExtractCode, "extract-code", false, help["extract-code"])
+	flag.BoolVar(&c.StopAfterCode, "stop-after-code", c.StopAfterCode, help["stop-after-code"])
+	flag.IntVar(&c.Sentences, "sentences", 0, help["sentences"])
+	flag.BoolVar(&c.RenderMath, "render-math", c.RenderMath, help["render-math"])
+	flag.BoolVar(&c.AllowANSI, "allow-ansi", c.AllowANSI, help["allow-ansi"])
+	flag.StringVar(&c.As, "as", "", help["as"])
+	flag.BoolVar(&c.Steps, "steps", false, help["steps"])
+	flag.BoolVar(&c.NoMarkdown, "no-markdown", false, help["no-markdown"])
+	flag.StringVar(&c.FIFO, "fifo", "", help["fifo"])
+	flag.StringSliceVar(&c.Compare, "compare", nil, help["compare"])
+	flag.Float32SliceVar(&c.TempSweep, "temp-sweep", nil, help["temp-sweep"])
+	flag.IntVar(&c.Brainstorm, "brainstorm", 0, help["brainstorm"])
+	flag.IntVar(&c.Choices, "choices", 0, help["choices"])
+	flag.BoolVar(&c.UseTools, "tools", false, help["tools"])
+	flag.BoolVar(&c.Yolo, "yolo", false, help["yolo"])
+	flag.BoolVar(&c.Bench, "bench", false, help["bench"])
+	flag.IntVarP(&c.BenchRuns, "runs", "n", 10, help["runs"]) //nolint:gomnd
+	flag.CommandLine.SetNormalizeFunc(func(_ *flag.FlagSet, name string) flag.NormalizedName {
+		if name == "n" {
+			// --n works too, like -n.
+			return "runs"
+		}
+		return flag.NormalizedName(name)
+	})
+	flag.BoolVar(&c.Copy, "copy", false, help["copy"])
+	flag.BoolVar(&c.Notify, "notify", false, help["notify"])
+	flag.IntVar(&c.Last, "last", 0, help["last"])
+	flag.BoolVar(&c.RedactSecrets, "redact", c.RedactSecrets, help["redact-secrets"])
+	flag.BoolVar(&c.Verbose, "verbose", false, help["verbose"])
 	flag.BoolVarP(&c.Settings, "settings", "s", false, help["settings"])
+	flag.BoolVar(&c.EditConfig, "edit-config", false, help["edit-config"])
 	flag.BoolVarP(&c.ShowHelp, "help", "h", false, help["help"])
 	flag.BoolVarP(&c.Version, "version", "v", false, help["version"])
+	flag.BoolVar(&c.ListAPIs, "list-apis", false, help["list-apis"])
+	flag.BoolVar(&c.ListRoles, "list-roles", false, help["list-roles"])
+	flag.StringVar(&c.SetDefaultAPI, "set-default-api", "", help["set-default-api"])
+	flag.StringVar(&c.Import, "import", "", help["import"])
+	flag.StringVar(&c.ExportAll, "export-all", "", help["export-all"])
+	flag.StringVar(&c.Pin, "pin", "", help["pin"])
+	flag.StringVar(&c.Unpin, "unpin", "", help["unpin"])
+	flag.StringVar(&c.Delete, "delete", "", help["delete"])
+	flag.BoolVar(&c.JSON, "json", false, help["json"])
+	flag.BoolVar(&c.Ping, "ping", false, help["ping"])
+	flag.BoolVar(&c.List, "list", false, help["list"])
+	flag.StringVar(&c.Since, "since", "", help["since"])
+	flag.StringVar(&c.Rename, "rename", "", help["rename"])
+	flag.BoolVar(&c.Overwrite, "overwrite", false, help["overwrite"])
 	flag.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, help["max-retries"])
 	flag.BoolVar(&c.NoLimit, "no-limit", c.NoLimit, help["no-limit"])
+	flag.IntVar(&c.MaxInputTokens, "max-input-tokens", c.MaxInputTokens, help["max-input-tokens"])
+	flag.StringVar(&c.Truncate, "truncate", c.Truncate, help["truncate"])
+	flag.Int64Var(&c.MaxInputBytes, "max-input", c.MaxInputBytes, help["max-input-bytes"])
+	flag.Int64Var(&c.MaxBufferBytes, "max-buffer-bytes", c.MaxBufferBytes, help["max-buffer-bytes"])
+	flag.BoolVar(&c.Yes, "yes", false, help["yes"])
 	flag.IntVar(&c.MaxTokens, "max-tokens", c.MaxTokens, help["max-tokens"])
 	flag.Float32Var(&c.Temperature, "temp", c.Temperature, help["temp"])
 	flag.Float32Var(&c.TopP, "topp", c.TopP, help["topp"])
+	flag.Float32Var(&c.PresencePenalty, "presence-penalty", c.PresencePenalty, help["presence-penalty"])
+	flag.Float32Var(&c.FrequencyPenalty, "frequency-penalty", c.FrequencyPenalty, help["frequency-penalty"])
+	flag.BoolVar(&c.Logprobs, "logprobs", false, help["logprobs"])
+	flag.IntVar(&c.TopLogprobs, "top-logprobs", 0, help["top-logprobs"])
+	flag.BoolVar(&c.Raw, "raw", false, help["raw"])
+	flag.BoolVar(&c.Pager, "pager", c.Pager, help["pager"])
+	flag.BoolVar(&c.CompactTables, "compact-tables", c.CompactTables, help["compact-tables"])
+	flag.BoolVar(&c.Speak, "speak", false, help["speak"])
+	flag.BoolVar(&c.MapReduce, "map-reduce", false, help["map-reduce"])
+	flag.BoolVar(&c.NoStream, "no-stream", false, help["no-stream"])
+	flag.IntVar(&c.Depth, "depth", 0, help["depth"])
+	flag.BoolVar(&c.NoTitle, "no-title", false, help["no-title"])
+	flag.BoolVar(&c.NoSave, "no-save", false, help["no-save"])
+	flag.StringVar(&c.ErrorFormat, "error-format", c.ErrorFormat, help["error-format"])
+	flag.StringVar(&c.Title, "title", "", help["title"])
+	flag.StringVar(&c.Continue, "continue", "", help["continue"])
+	flag.BoolVar(&c.Echo, "echo", c.Echo, help["echo"])
+	flag.BoolVar(&c.PersistParams, "persist-params", false, help["persist-params"])
+	flag.StringVar(&c.ContinueGeneration, "continue-generation", "", help["continue-generation"])
+	flag.BoolVar(&c.Scratch, "scratch", false, help["scratch"])
+	flag.StringVar(&c.Examples, "examples", c.Examples, help["examples"])
+	flag.Var(messageFlag{openai.ChatMessageRoleUser, &c.Messages}, "user", help["user"])
+	flag.Var(messageFlag{openai.ChatMessageRoleAssistant, &c.Messages}, "assistant", help["assistant"])
+	flag.BoolVar(&c.ScratchReset, "scratch-reset", false, help["scratch-reset"])
+	flag.BoolVar(&c.ShowContext, "show-context", c.ShowContext, help["show-context"])
+	flag.StringVar(&c.Replay, "replay", "", help["replay"])
+	flag.BoolVar(&c.ReplayLast, "replay-last", false, help["replay-last"])
+	flag.StringVar(&c.MapReducePrompt, "map-reduce-prompt", c.MapReducePrompt, help["map-reduce-prompt"])
+	flag.StringVar(&c.SpeakCommand, "speak-command", c.SpeakCommand, help["speak-command"])
+	flag.BoolVar(&c.NoPager, "no-pager", false, help["no-pager"])
+	flag.BoolVar(&c.NoRemember, "no-remember", false, help["no-remember"])
+	flag.BoolVar(&c.NoHistory, "no-history", false, help["no-history"])
 	flag.UintVar(&c.Fanciness, "fanciness", c.Fanciness, help["fanciness"])
+	flag.UintVar(&c.AnimationWidth, "animation-width", c.AnimationWidth, help["animation-width"])
+	flag.BoolVar(&c.NoAnimation, "no-animation", c.NoAnimation, help["no-animation"])
+	flag.StringVar(&c.GradientBlend, "gradient-blend", c.GradientBlend, help["gradient-blend"])
+	flag.StringVar(&c.Theme, "theme", c.Theme, help["theme"])
+	flag.StringVar(&c.ThemeFile, "theme-file", c.ThemeFile, help["theme-file"])
 	flag.StringVar(&c.StatusText, "status-text", c.StatusText, help["status-text"])
+	flag.StringVar(&c.SystemPrefix, "system-prefix", c.SystemPrefix, help["system-prefix"])
+	flag.StringVar(&c.SystemSuffix, "system-suffix", c.SystemSuffix, help["system-suffix"])
+	flag.StringVar(&c.System, "system", c.System, help["system"])
+	flag.StringVar(&c.SystemMode, "system-mode", c.SystemMode, help["system-mode"])
+	flag.StringVar(&c.PromptSeparator, "prompt-separator", c.PromptSeparator, help["prompt-separator"])
+	flag.BoolVar(&c.ShowSystem, "show-system", false, help["show-system"])
+	flag.BoolVar(&c.PrintConfig, "print-config", false, help["print-config"])
+	flag.BoolVar(&c.ShowSecrets, "show-secrets", false, help["show-secrets"])
+	flag.BoolVar(&c.PromptOnly, "prompt-only", false, help["prompt-only"])
+	flag.StringVar(&c.ContextFile, "context-file", c.ContextFile, help["context-file"])
+	flag.BoolVar(&c.NoContext, "no-context", false, help["no-context"])
+	flag.StringArrayVar(&c.Vars, "var", nil, help["var"])
+	flag.StringArrayVar(&c.LogitBias, "logit-bias", nil, help["logit-bias"])
+	flag.StringVar(&c.UserID, "user-id", c.UserID, help["user-id"])
+	flag.StringVar(&c.RawRequest, "raw-request", "", help["raw-request"])
+	flag.BoolVar(&c.TTY, "tty", c.TTY, help["tty"])
+	flag.BoolVar(&c.Think, "think", c.Think, help["think"])
+	flag.BoolVar(&c.ShowReasoning, "show-reasoning", false, help["show-reasoning"])
+	flag.BoolVar(&c.ReasoningContext, "reasoning-context", c.ReasoningContext, help["reasoning-context"])
+	flag.BoolVar(&c.CompactHistory, "compact-history", c.CompactHistory, help["compact-history"])
+	flag.BoolVar(&c.Web, "web", c.Web, help["web"])
+	flag.BoolVar(&c.Stats, "stats", c.Stats, help["stats"])
+	flag.BoolVar(&c.ShowUsage, "show-usage", c.ShowUsage, help["show-usage"])
+	flag.BoolVar(&c.Trace, "trace", c.Trace, help["trace"])
+	flag.BoolVar(&c.ShowBudget, "show-budget", c.ShowBudget, help["show-budget"])
+	flag.BoolVar(&c.RetryOnTruncation, "retry-on-truncation", c.RetryOnTruncation, help["retry-on-truncation"])
+	flag.BoolVar(&c.RetryOnEmpty, "retry-on-empty", c.RetryOnEmpty, help["retry-on-empty"])
+	flag.BoolVar(&c.RetryOnDrop, "retry-on-drop", c.RetryOnDrop, help["retry-on-drop"])
+	flag.StringVar(&c.LineEndings, "line-endings", c.LineEndings, help["line-endings"])
+	flag.StringVar(&c.CodeStyle, "code-style", c.CodeStyle, help["code-style"])
 	flag.Lookup("prompt").NoOptDefVal = "-1"
-	flag.Usage = usage
+	flag.Lookup("last").NoOptDefVal = "1"
+	flag.Usage = func() { usage(c.theme, c.GradientBlend) }
 	flag.CommandLine.SortFlags = false
-	flag.Parse()
+	// MODS_ARGS comes first so the flags given explicitly override it.
+	args, err := splitArgs(os.Getenv("MODS_ARGS"))
+	if err != nil {
+		return c, fmt.Errorf("invalid MODS_ARGS: %w", err)
+	}
+	if err := flag.CommandLine.Parse(append(args, os.Args[1:]...)); err != nil {
+		return c, err
+	}
 	c.Prefix = strings.Join(flag.Args(), " ")
+	if c.Last > 0 && flag.NArg() == 1 {
+		// Allow --last 2 as well as --last=2.
+		if n, err := strconv.Atoi(flag.Arg(0)); err == nil {
+			c.Last = n
+			c.Prefix = ""
+		}
+	}
+	if c.NoRemember {
+		c.Remember = false
+	}
+	if c.Remember {
+		c.remember()
+	}
+
+	c.applyRole()
+	c.Model = c.resolveModel(c.Model)
+	c.TitleModel = c.resolveModel(c.TitleModel)
+	for i, model := range c.Compare {
+		c.Compare[i] = c.resolveModel(model)
+	}
+	if c.NoPager {
+		c.Pager = false
+	}
+	if c.NoTitle {
+		c.AutoTitle = false
+	}
+	if c.ErrorFormat != "" && c.ErrorFormat != "text" && c.ErrorFormat != "json" {
+		f := c.ErrorFormat
+		c.ErrorFormat = ""
+		return c, fmt.Errorf("unknown error-format %q, expected text or json", f)
+	}
+	if c.SystemMode != "append" && c.SystemMode != "replace" {
+		return c, fmt.Errorf("unknown system-mode %q, expected append or replace", c.SystemMode)
+	}
+	if _, ok := anim.Blends[c.GradientBlend]; !ok {
+		return c, fmt.Errorf("unknown gradient-blend %q, expected luv, lab, hcl or rgb", c.GradientBlend)
+	}
+	c.theme, err = loadTheme(c.Theme, c.ThemeFile)
+	if err != nil {
+		return c, err
+	}
+	if c.CodeStyle == "" {
+		c.CodeStyle = c.theme.CodeStyle
+	}
+	if c.Sentences < 0 {
+		return c, fmt.Errorf("invalid sentences %d, expected a positive number", c.Sentences)
+	}
+	switch {
+	case c.Choices < 0:
+		return c, fmt.Errorf("invalid choices %d, expected a positive number", c.Choices)
+	case c.Choices > 1 && c.Chat:
+		return c, errors.New("--choices and --chat can't be used together")
+	case c.UseTools && len(c.Tools) == 0:
+		return c, errors.New("--tools needs tools in the settings, see mods -s")
+	case c.Yolo && !c.UseTools:
+		return c, errors.New("--yolo only applies to --tools")
+	}
+	for _, t := range c.Tools {
+		if err := t.validate(); err != nil {
+			return c, err
+		}
+	}
+	if c.ToolSandbox != "" {
+		if _, err := c.sandboxed("true"); err != nil {
+			return c, err
+		}
+	}
+	switch {
+	case c.MaxInputTokens < 0:
+		return c, fmt.Errorf("invalid max-input-tokens %d, expected a positive number", c.MaxInputTokens)
+	case c.Truncate != truncateHead && c.Truncate != truncateTail && c.Truncate != truncateMiddle:
+		return c, fmt.Errorf("unknown truncate %q, expected head, tail or middle", c.Truncate)
+	}
+	if c.LineEndings != "lf" && c.LineEndings != "crlf" && c.LineEndings != "native" {
+		return c, fmt.Errorf("unknown line-endings %q, expected lf, crlf or native", c.LineEndings)
+	}
+	switch c.As {
+	case "", "code", "markdown", "text", "auto":
+	default:
+		return c, fmt.Errorf("unknown --as %q, expected code, markdown, text or auto", c.As)
+	}
+	if c.NoMarkdown {
+		c.Markdown = false
+	}
+	if c.OutputFormat == "json" && !c.Steps {
+		return c, errors.New("--format=json prints the steps of --steps, use --format=full-json for the whole response")
+	}
+	if c.As != "" {
+		// The response is printed alone, to be piped.
+		c.Raw = true
+	}
+	if c.NoGitDiff {
+		c.GitDiff = false
+	}
+	for name := range c.Roles {
+		if _, ok := builtinRoles[name]; ok {
+			return c, fmt.Errorf("the role %s of the settings has the name of a built-in role", name)
+		}
+	}
+	for model, role := range c.ModelRoles {
+		if !c.isRole(role) {
+			return c, fmt.Errorf("unknown role %q for %s in model-roles, the roles are %s", role, model, strings.Join(c.roleNames(), ", "))
+		}
+	}
+	for role := range c.RoleOutputs {
+		if _, ok := builtinRoles[role]; ok {
+			continue
+		}
+		if _, ok := c.Roles[role]; ok {
+			return c, fmt.Errorf("role-outputs is for the built-in roles, set the output of %q under roles instead", role)
+		}
+		return c, fmt.Errorf("unknown role %q in role-outputs, the built-in roles are %s", role, strings.Join(config{}.roleNames(), ", "))
+	}
+	if c.Role == "" {
+		c.Role = c.modelRole()
+	}
+	if c.roleOutput() == "clipboard" {
+		c.Copy = true
+	}
+	if c.Role != "" && !c.isRole(c.Role) {
+		return c, fmt.Errorf("unknown role %q, the roles are %s", c.Role, strings.Join(c.roleNames(), ", "))
+	}
+	if c.Commit {
+		if c.CommitStyle != "conventional" && c.CommitStyle != "simple" {
+			return c, fmt.Errorf("unknown commit-style %q, expected conventional or simple", c.CommitStyle)
+		}
+		// Only the message is printed, to pipe it into git commit -F -. It's
+		// written from the diff, whatever git-diff is set to.
+		c.GitContext = true
+		c.GitDiff = true
+		c.Raw = true
+		c.Markdown = false
+		c.AutoSave = false
+		c.Title = ""
+	}
+	if c.Scratch {
+		if c.Continue != "" {
+			return c, errors.New("--scratch and --continue can't be used together")
+		}
+		// Saving under the reserved title is what keeps the thread going.
+		c.Title = scratchTitle
+	}
+	if c.ContinueGeneration != "" {
+		switch {
+		case c.Continue != "" || c.Scratch:
+			return c, errors.New("--continue-generation continues the conversation it's given, it can't be used with --continue or --scratch")
+		case c.Chat:
+			return c, errors.New("--continue-generation and --chat can't be used together")
+		case c.Prefix != "":
+			return c, errors.New("--continue-generation doesn't take a prompt")
+		}
+		c.Continue = c.ContinueGeneration
+		c.Prefix = continuationPrompt
+	}
+	if c.PersistParams && c.Continue == "" && !c.Scratch {
+		return c, errors.New("--persist-params updates the parameters of the conversation given to --continue or --scratch")
+	}
+	if c.PromptOnly {
+		// Nothing is sent, so there's nothing to wait for or to save.
+		c.Raw = true
+		c.Quiet = true
+		c.AutoSave = false
+		c.Title = ""
+	}
+	if c.NoSave {
+		c.AutoSave = false
+	}
+	if c.Bench {
+		if c.Prefix == "" {
+			c.Prefix = defaultBenchPrompt
+		}
+		if c.BenchRuns < 1 {
+			return c, errors.New("--runs must be at least 1")
+		}
+		// The benchmark isn't a conversation.
+		c.AutoSave = false
+		c.Title = ""
+	}
+	if c.CodeStyle != "" && chromastyles.Registry[c.CodeStyle] == nil {
+		return c, fmt.Errorf("unknown code-style %q, see https://xyproto.github.io/splash/docs/ for the styles", c.CodeStyle)
+	}
+	if err := checkPenalty("presence-penalty", c.PresencePenalty); err != nil {
+		return c, err
+	}
+	if err := checkPenalty("frequency-penalty", c.FrequencyPenalty); err != nil {
+		return c, err
+	}
 
+	if yamlErr != nil && !c.Settings && !c.EditConfig {
+		return c, yamlErr
+	}
 	return c, nil
 }
 
-func usage() {
+// saveDefaultAPI persists the given API as the default-api of the settings
+// file, keeping the rest of the file untouched.
+func saveDefaultAPI(path, api string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	line := "default-api: " + api
+	re := regexp.MustCompile(`(?m)^(# )?default-api:.*$`)
+	if re.Match(content) {
+		content = re.ReplaceAll(content, []byte(line))
+	} else {
+		content = append(bytes.TrimRight(content, "\n"), []byte("\n"+line+"\n")...)
+	}
+	return os.WriteFile(path, content, 0o600) //nolint:gomnd
+}
+
+func usage(t theme, blend string) {
 	r := lipgloss.DefaultRenderer()
 	s := makeStyles(r)
 	appName := filepath.Base(os.Args[0])
 
 	if r.ColorProfile() == termenv.TrueColor {
-		appName = makeGradientText(s.appName, appName)
+		appName = anim.Text(s.appName, appName, t.gradient(blend))
 	}
 
 	fmt.Printf("GPT on the command line. Built for pipelines.\n\n")
@@ -247,3 +1138,196 @@ func usage() {
 		cheapHighlighting(s, example),
 	)
 }
+
+// defaultLastResponses is used by settings files created before
+// last-responses was added.
+const defaultLastResponses = 10
+
+const configErrorPrefix = "# ERROR: "
+
+// editConfig opens the settings file in the user's editor until it's saved
+// without errors. When the settings are invalid the error is written at the
+// top of the file and the editor is opened again. Leaving the file untouched
+// gives up and returns the error.
+func editConfig(path string) error {
+	for {
+		before, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := runEditor(path); err != nil {
+			return &editorError{err}
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content = stripConfigError(content)
+		merged, _, verr := mergeSettingsDir(content, path)
+		if verr == nil {
+			verr = validateConfig(merged)
+		}
+		if verr == nil {
+			return os.WriteFile(path, content, 0o600) //nolint:gomnd
+		}
+		if bytes.Equal(stripConfigError(before), content) && bytes.HasPrefix(before, []byte(configErrorPrefix)) {
+			return verr
+		}
+		var b bytes.Buffer
+		for _, line := range strings.Split(verr.Error(), "\n") {
+			b.WriteString(configErrorPrefix + line + "\n")
+		}
+		b.Write(content)
+		if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil { //nolint:gomnd
+			return err
+		}
+	}
+}
+
+// editorError is returned when the editor itself fails to run.
+type editorError struct{ err error }
+
+func (e *editorError) Error() string { return e.err.Error() }
+
+// runEditor opens the file in $EDITOR, falling back to vi, or notepad on
+// Windows.
+func runEditor(path string) error {
+	args := strings.Fields(os.Getenv("EDITOR"))
+	if len(args) == 0 {
+		args = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			args = []string{"notepad"}
+		}
+	}
+	c := exec.Command(args[0], append(args[1:], path)...) //nolint:gosec
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// stripConfigError removes the error lines added by editConfig.
+func stripConfigError(content []byte) []byte {
+	for bytes.HasPrefix(content, []byte(configErrorPrefix)) {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			return nil
+		}
+		content = content[i+1:]
+	}
+	return content
+}
+
+// validateConfig checks the settings can be parsed and that the default
+// model and API, and the model fallbacks, are configured.
+func validateConfig(content []byte) error {
+	var c config
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("the settings file is empty")
+		}
+		return err
+	}
+	models := map[string]bool{}
+	for _, api := range c.APIs {
+		for name, mod := range api.Models {
+			models[name] = true
+			for _, a := range mod.Aliases {
+				models[a] = true
+			}
+		}
+	}
+	if c.API != "" {
+		if _, ok := c.APIs[c.API]; !ok && c.API != mockAPI {
+			return fmt.Errorf("default-api %q is not one of the configured apis", c.API)
+		}
+	} else if c.Model != "" && !models[c.Model] {
+		return fmt.Errorf("default-model %q is not one of the configured models", c.Model)
+	}
+	for apiName, api := range c.APIs {
+		for name, mod := range api.Models {
+			if mod.Fallback != "" && !models[mod.Fallback] {
+				return fmt.Errorf("fallback %q of model %q in api %q is not one of the configured models", mod.Fallback, name, apiName)
+			}
+		}
+	}
+	return nil
+}
+
+func checkPenalty(name string, v float32) error {
+	if v < -2 || v > 2 {
+		return fmt.Errorf("%s must be between -2.0 and 2.0, got %g", name, v)
+	}
+	return nil
+}
+
+// splitArgs splits s in arguments the way a shell would, with single and
+// double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// defaultSettings renders the settings file written on the first run.
+func defaultSettings(c config, help map[string]string) ([]byte, error) {
+	tmpl, err := template.New("config").Parse(strings.TrimSpace(configTemplate))
+	if err != nil {
+		return nil, err
+	}
+	m := struct {
+		Config config
+		Help   map[string]string
+	}{
+		Config: c,
+		Help:   help,
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, m); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeSettings(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:gomnd
+		return err
+	}
+	return os.WriteFile(path, content, 0o600) //nolint:gomnd
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	flag "github.com/spf13/pflag"
+)
+
+// conversationParams are the model parameters of a saved conversation, used
+// again when it's continued.
+type conversationParams struct {
+	Temperature      float32 `json:"temp"`
+	TopP             float32 `json:"topp"`
+	MaxTokens        int     `json:"max_tokens,omitempty"`
+	PresencePenalty  float32 `json:"presence_penalty"`
+	FrequencyPenalty float32 `json:"frequency_penalty"`
+}
+
+func paramsOf(c config) conversationParams {
+	return conversationParams{
+		Temperature:      c.Temperature,
+		TopP:             c.TopP,
+		MaxTokens:        c.MaxTokens,
+		PresencePenalty:  c.PresencePenalty,
+		FrequencyPenalty: c.FrequencyPenalty,
+	}
+}
+
+// apply sets the parameters in the settings, except the ones given with a
+// flag, which only apply to this run unless --persist-params is used.
+func (p conversationParams) apply(c *config) {
+	if !flag.CommandLine.Changed("temp") {
+		c.Temperature = p.Temperature
+	}
+	if !flag.CommandLine.Changed("topp") {
+		c.TopP = p.TopP
+	}
+	if !flag.CommandLine.Changed("max-tokens") {
+		c.MaxTokens = p.MaxTokens
+	}
+	if !flag.CommandLine.Changed("presence-penalty") {
+		c.PresencePenalty = p.PresencePenalty
+	}
+	if !flag.CommandLine.Changed("frequency-penalty") {
+		c.FrequencyPenalty = p.FrequencyPenalty
+	}
+}
+
+// continueConversation loads the saved conversation given to --continue so
+// the next messages keep its context and get saved to it. With last, it's
+// the most recently updated one.
+func (m *Mods) continueConversation() error {
+	find := findConversation
+	if m.Config.Continue == "last" {
+		find = func(string) (conversation, error) { return lastConversation() }
+	}
+	c, err := find(m.Config.Continue)
+	if err != nil {
+		return err
+	}
+	m.chatID = c.ID
+	m.messages = c.Messages
+	m.reasoning = c.Reasoning
+	if c.Params != nil {
+		c.Params.apply(&m.Config)
+	}
+	m.continued = &c
+	return nil
+}
+
+// conversationHeader describes the conversation being continued.
+func conversationHeader(c conversation) string {
+	return "Continuing " + conversationSummary(c)
+}
+
+// conversationSummary describes the conversation with its title, model,
+// number of turns and last update.
+func conversationSummary(c conversation) string {
+	name := c.ID
+	if c.Title != "" {
+		name = fmt.Sprintf("“%s” (%s)", c.Title, c.ID)
+	}
+	turns := 0
+	for _, msg := range c.Messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			turns++
+		}
+	}
+	parts := []string{name}
+	if c.Model != "" {
+		parts = append(parts, c.Model)
+	}
+	unit := "turns"
+	if turns == 1 {
+		unit = "turn"
+	}
+	parts = append(parts, fmt.Sprintf("%d %s", turns, unit))
+	parts = append(parts, "updated "+formatAge(c.UpdatedAt, time.Now()))
+	return strings.Join(parts, " · ")
+}
+
+// formatAge returns how long before now t was, like "3 hours ago".
+func formatAge(t, now time.Time) string {
+	d := now.Sub(t)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "minute")
+	case d < 24*time.Hour: //nolint:gomnd
+		return plural(int(d.Hours()), "hour")
+	case d < 30*24*time.Hour: //nolint:gomnd
+		return plural(int(d.Hours()/24), "day") //nolint:gomnd
+	}
+	return "on " + t.Format("January 2, 2006")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/adrg/xdg"
+	openai "github.com/sashabaranov/go-openai"
+	flag "github.com/spf13/pflag"
+)
+
+// setFlags replaces the flags of the command line with ones where the given
+// flags were passed, for the duration of the test.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("mods", flag.ContinueOnError)
+	for name, value := range values {
+		flag.String(name, "", "")
+		if err := flag.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// tempDataHome points the data directory to a temporary one for the duration
+// of the test.
+func tempDataHome(t *testing.T) {
+	t.Helper()
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	xdg.Reload()
+}
+
+var savedParams = conversationParams{
+	Temperature:      0.7,
+	TopP:             0.9,
+	MaxTokens:        500,
+	PresencePenalty:  0.1,
+	FrequencyPenalty: 0.2,
+}
+
+func TestConversationParamsApply(t *testing.T) {
+	setFlags(t, map[string]string{"temp": "0.2", "max-tokens": "100"})
+	cfg := config{Temperature: 0.2, TopP: 1, MaxTokens: 100}
+	savedParams.apply(&cfg)
+	want := conversationParams{
+		Temperature:      0.2,
+		TopP:             0.9,
+		MaxTokens:        100,
+		PresencePenalty:  0.1,
+		FrequencyPenalty: 0.2,
+	}
+	if got := paramsOf(cfg); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveConversationParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		persist bool
+		want    conversationParams
+	}{
+		{
+			// The flags only apply to this run.
+			name: "per turn",
+			want: savedParams,
+		},
+		{
+			name:    "persisted",
+			persist: true,
+			want: conversationParams{
+				Temperature:      0.2,
+				TopP:             0.9,
+				MaxTokens:        500,
+				PresencePenalty:  0.1,
+				FrequencyPenalty: 0.2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDataHome(t)
+			setFlags(t, map[string]string{"temp": "0.2"})
+			params := savedParams
+			old := conversation{ID: "params", Model: "gpt-4o", Params: &params}
+			if _, err := writeConversation(old); err != nil {
+				t.Fatal(err)
+			}
+
+			m := &Mods{Config: config{Temperature: 0.2, Continue: old.ID, PersistParams: tt.persist}}
+			if err := m.continueConversation(); err != nil {
+				t.Fatal(err)
+			}
+			if m.Config.Temperature != 0.2 || m.Config.TopP != savedParams.TopP {
+				t.Errorf("got temp %v and top p %v for this run, want 0.2 and %v", m.Config.Temperature, m.Config.TopP, savedParams.TopP)
+			}
+			m.messages = append(m.messages, userMessage("hi"), assistantMessage("hello"))
+			if _, err := m.saveConversation(false); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := readConversation(old.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Params == nil || *c.Params != tt.want {
+				t.Errorf("got saved params %+v, want %+v", c.Params, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveConversationParamsNew(t *testing.T) {
+	tempDataHome(t)
+	cfg := config{Temperature: 0.3, TopP: 0.8, MaxTokens: 42}
+	m := &Mods{Config: cfg, messages: []openai.ChatCompletionMessage{userMessage("hi")}}
+	if _, err := m.saveConversation(false); err != nil {
+		t.Fatal(err)
+	}
+	c, err := readConversation(m.chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Params == nil || *c.Params != paramsOf(cfg) {
+		t.Errorf("got saved params %+v, want %+v", c.Params, paramsOf(cfg))
+	}
+}
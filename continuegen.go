@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// continuationPrompt asks the model to pick up a response it was stopped in
+// the middle of by --max-tokens.
+const continuationPrompt = `Your last response was cut off. Continue it exactly where it stopped, without repeating any of it and without any introduction.`
+
+// maxOverlap is the most of the end of the response looked for at the start
+// of its continuation.
+const maxOverlap = 200
+
+// minOverlap is the least a continuation has to repeat of the response for
+// the repetition to be dropped.
+const minOverlap = 8
+
+// checkContinuation returns an error if the conversation given to
+// --continue-generation doesn't end with a response to continue.
+func (m *Mods) checkContinuation() error {
+	if len(m.messages) == 0 || m.messages[len(m.messages)-1].Role != openai.ChatMessageRoleAssistant {
+		return errors.New("the conversation doesn't end with a response")
+	}
+	return nil
+}
+
+// continueResponse adds the continuation to the last response of the
+// conversation, which is then printed and saved in its place.
+func (m *Mods) continueResponse(continuation string) {
+	last := &m.messages[len(m.messages)-1]
+	last.Content = stitchContinuation(last.Content, continuation)
+	m.Output = last.Content
+}
+
+// stitchContinuation joins the response and its continuation. The part of
+// the response the model repeated, and the code fence reopening the block the
+// response stopped in, are dropped. A space is added after a sentence cut
+// right after its punctuation.
+func stitchContinuation(response, continuation string) string {
+	n := maxOverlap
+	if len(response) < n {
+		n = len(response)
+	}
+	if len(continuation) < n {
+		n = len(continuation)
+	}
+	for ; n >= minOverlap; n-- {
+		if strings.HasSuffix(response, continuation[:n]) {
+			continuation = continuation[n:]
+			break
+		}
+	}
+	if strings.Count(response, "```")%2 == 1 {
+		if rest := strings.TrimLeft(continuation, " \n"); strings.HasPrefix(rest, "```") {
+			_, continuation, _ = strings.Cut(rest, "\n")
+			if !strings.HasSuffix(response, "\n") {
+				continuation = "\n" + continuation
+			}
+		}
+	}
+	last, _ := utf8.DecodeLastRuneInString(response)
+	first, _ := utf8.DecodeRuneInString(continuation)
+	if strings.ContainsRune(".,;:!?", last) && !unicode.IsSpace(first) && !unicode.IsPunct(first) && continuation != "" {
+		continuation = " " + continuation
+	}
+	return response + continuation
+}
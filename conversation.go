@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// conversation is a chat session saved to disk.
+type conversation struct {
+	ID        string                         `json:"id"`
+	Title     string                         `json:"title,omitempty"`
+	Pinned    bool                           `json:"pinned,omitempty"`
+	Model     string                         `json:"model"`
+	CreatedAt time.Time                      `json:"created_at"`
+	UpdatedAt time.Time                      `json:"updated_at"`
+	Messages  []openai.ChatCompletionMessage `json:"messages"`
+	// Reasoning holds the reasoning behind the responses, by the index of
+	// their message. It's kept apart so it isn't sent back to the model.
+	Reasoning map[int]string `json:"reasoning,omitempty"`
+	// Params are the model parameters the conversation was started with, or
+	// last given with --persist-params.
+	Params *conversationParams `json:"params,omitempty"`
+}
+
+func userMessage(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content}
+}
+
+func assistantMessage(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+}
+
+func conversationPath(id string) (string, error) {
+	if id == "" {
+		return "", errors.New("missing conversation ID")
+	}
+	// The ID is used as the file name.
+	id = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '.' {
+			return '-'
+		}
+		return r
+	}, id)
+	return xdg.DataFile(filepath.Join("mods", "conversations", id+".json"))
+}
+
+// conversationIDs returns the IDs of the saved conversations, sorted.
+func conversationIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(xdg.DataHome, "mods", "conversations"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return ids, nil
+}
+
+// saving returns whether the conversation should be saved: always with
+// --title, or else unless --no-save or auto-save: false say otherwise.
+func (c config) saving() bool {
+	return c.Title != "" || c.AutoSave
+}
+
+// saveConversation writes the current chat to the conversations directory.
+// Saving again updates the same file until the conversation is reset. With
+// autoTitle set, conversations without a title get one from the model.
+func (m *Mods) saveConversation(autoTitle bool) (string, error) {
+	now := time.Now()
+	if m.chatID == "" {
+		m.chatID = newConversationID(now)
+	}
+	c := conversation{
+		ID:        m.chatID,
+		Model:     m.Config.Model,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Messages:  m.messages,
+		Reasoning: m.reasoning,
+	}
+	if old, err := readConversation(m.chatID); err == nil {
+		c.CreatedAt = old.CreatedAt
+		c.Title = old.Title
+		c.Pinned = old.Pinned
+		c.Params = old.Params
+	}
+	if c.Params == nil && m.continued == nil || m.Config.PersistParams {
+		// Conversations saved before the parameters were kept get them
+		// with --persist-params only.
+		params := paramsOf(m.Config)
+		c.Params = &params
+	}
+	if m.Config.Title != "" {
+		c.Title = m.Config.Title
+	}
+	if c.Title == "" && autoTitle {
+		c.Title = m.conversationTitle()
+	}
+	path, err := writeConversation(c)
+	if err != nil || m.Config.MaxConversations <= 0 {
+		return path, err
+	}
+	evicted, err := evictConversations(m.Config.MaxConversations, c.ID)
+	m.evicted = append(m.evicted, evicted...)
+	return path, err
+}
+
+// evictConversations deletes the least recently updated conversations until
+// there are at most limit of them, keeping the pinned ones and the one with the
+// given ID. It returns the deleted conversations.
+func evictConversations(limit int, keep string) ([]conversation, error) {
+	ids, err := conversationIDs()
+	if err != nil || len(ids) <= limit {
+		return nil, err
+	}
+	var candidates []conversation
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err == nil && !c.Pinned && c.ID != keep {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].UpdatedAt.Before(candidates[j].UpdatedAt) })
+	var evicted []conversation
+	for n := len(ids); n > limit && len(candidates) > 0; n-- {
+		c := candidates[0]
+		candidates = candidates[1:]
+		path, err := conversationPath(c.ID)
+		if err != nil {
+			return evicted, err
+		}
+		if err := os.Remove(path); err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, c)
+	}
+	return evicted, nil
+}
+
+// evictionNotice lists the conversations deleted to stay under
+// max-conversations, for --verbose.
+func evictionNotice(evicted []conversation) string {
+	lines := make([]string, 0, len(evicted)+1)
+	unit := "conversations"
+	if len(evicted) == 1 {
+		unit = "conversation"
+	}
+	lines = append(lines, fmt.Sprintf("Deleted %d old %s to stay under max-conversations:", len(evicted), unit))
+	for _, c := range evicted {
+		lines = append(lines, "  "+conversationSummary(c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newConversationID returns an ID for a new conversation from its creation
+// time, with a suffix if one was already created in that second.
+func newConversationID(now time.Time) string {
+	id := now.Format("20060102-150405")
+	for i := 2; ; i++ {
+		path, err := conversationPath(id)
+		if err != nil {
+			return id
+		}
+		if _, err := os.Stat(path); err != nil {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+}
+
+func readConversation(id string) (conversation, error) {
+	var c conversation
+	path, err := conversationPath(id)
+	if err != nil {
+		return c, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(b, &c)
+}
+
+// findConversation returns the saved conversation with the given ID or
+// title.
+func findConversation(s string) (conversation, error) {
+	if c, err := readConversation(s); err == nil {
+		return c, nil
+	}
+	ids, err := conversationIDs()
+	if err != nil {
+		return conversation{}, err
+	}
+	var found []conversation
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err == nil && strings.EqualFold(c.Title, s) {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return conversation{}, fmt.Errorf("There is no conversation with the ID or title %q.", s)
+	case 1:
+		return found[0], nil
+	default:
+		matches := make([]string, 0, len(found))
+		for _, c := range found {
+			matches = append(matches, c.ID)
+		}
+		return conversation{}, fmt.Errorf("Several conversations are titled %q, use one of their IDs instead: %s", s, strings.Join(matches, ", "))
+	}
+}
+
+// lastConversation returns the most recently updated saved conversation.
+func lastConversation() (conversation, error) {
+	ids, err := conversationIDs()
+	if err != nil {
+		return conversation{}, err
+	}
+	var last conversation
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err == nil && (last.ID == "" || c.UpdatedAt.After(last.UpdatedAt)) {
+			last = c
+		}
+	}
+	if last.ID == "" {
+		return last, errors.New("There are no saved conversations yet.")
+	}
+	return last, nil
+}
+
+// pinConversation sets whether the conversation is pinned, pinned
+// conversations being kept when deleting conversations in bulk.
+func pinConversation(s string, pinned bool) (conversation, error) {
+	c, err := findConversation(s)
+	if err != nil {
+		return c, err
+	}
+	c.Pinned = pinned
+	_, err = writeConversation(c)
+	return c, err
+}
+
+// deleteConversation deletes the conversation with the given ID or title.
+func deleteConversation(s string) (conversation, error) {
+	c, err := findConversation(s)
+	if err != nil {
+		return c, err
+	}
+	path, err := conversationPath(c.ID)
+	if err != nil {
+		return c, err
+	}
+	return c, os.Remove(path)
+}
+
+// renameConversation changes the title of the conversation. It fails if
+// another conversation has that title, unless overwrite is set, in which case
+// the others lose it and remain available by their ID.
+func renameConversation(s, title string, overwrite bool) (conversation, error) {
+	c, err := findConversation(s)
+	if err != nil {
+		return c, err
+	}
+	ids, err := conversationIDs()
+	if err != nil {
+		return c, err
+	}
+	var taken []conversation
+	for _, id := range ids {
+		other, err := readConversation(id)
+		if err == nil && other.ID != c.ID && strings.EqualFold(other.Title, title) {
+			taken = append(taken, other)
+		}
+	}
+	if len(taken) > 0 && !overwrite {
+		return c, fmt.Errorf("The conversation %s is already titled %q, add --overwrite to take the title anyway.", taken[0].ID, taken[0].Title)
+	}
+	for _, other := range taken {
+		other.Title = ""
+		if _, err := writeConversation(other); err != nil {
+			return c, err
+		}
+	}
+	c.Title = title
+	_, err = writeConversation(c)
+	return c, err
+}
+
+// writeConversation writes the conversation to the conversations directory
+// and returns its path.
+func writeConversation(c conversation) (string, error) {
+	path, err := conversationPath(c.ID)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, b, 0o600) //nolint:gomnd
+}
+
+// writeTranscript writes the messages as a Markdown transcript.
+func writeTranscript(path string, messages []openai.ChatCompletionMessage) error {
+	var b strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "**%s:**\n\n%s\n\n", msg.Role, strings.TrimSpace(msg.Content))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o600) //nolint:gomnd
+}
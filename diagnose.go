@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const diagnoseRole = `The user gives you the output of a command that
+failed, its standard output and errors mixed, and maybe what they were doing.
+Start with the error that matters in one sentence, ignoring the noise around
+it, then its likely cause. Then list the fixes as numbered steps the user can
+take right away, with the commands and code changes in code blocks, the most
+likely fix first. Don't repeat the output back.`
+
+// stackTraces recognize the stack traces of the common languages, by the
+// name of the language, used as the language of the code block they're sent
+// in.
+var stackTraces = []struct {
+	lang string
+	re   *regexp.Regexp
+}{
+	{"go", regexp.MustCompile(`(?m)^(panic: |fatal error: )|^goroutine \d+ \[[a-z ]+\]:$`)},
+	{"python", regexp.MustCompile(`(?m)^Traceback \(most recent call last\):$`)},
+	{"rust", regexp.MustCompile(`(?m)^thread '[^']*' panicked at `)},
+	{"java", regexp.MustCompile(`(?m)^\s+at [\w$.]+\([\w$]+\.(java|kt|scala):\d+\)$`)},
+	{"javascript", regexp.MustCompile(`(?m)^\s+at .*\.(js|mjs|cjs|ts):\d+:\d+\)?$`)},
+	{"ruby", regexp.MustCompile(`(?m)^\S+\.rb:\d+:in `)},
+}
+
+// stackTraceLanguage returns the language of the stack trace in the output,
+// or an empty string if there's none.
+func stackTraceLanguage(output string) string {
+	for _, st := range stackTraces {
+		if st.re.MatchString(output) {
+			return st.lang
+		}
+	}
+	return ""
+}
+
+// diagnosis returns the message sent for the output to diagnose. A stack
+// trace is sent as code of its language, asking for the frame where things
+// went wrong.
+func diagnosis(output string) string {
+	output = strings.Trim(output, "\n")
+	lang := stackTraceLanguage(output)
+	if lang == "" {
+		return fmt.Sprintf("Output of the command:\n\n```\n%s\n```", output)
+	}
+	return fmt.Sprintf("The output has a %s stack trace. Point at the frame of "+
+		"my code where it went wrong, past the frames of the runtime and the "+
+		"libraries, and show the fix there.\n\n```%s\n%s\n```", stackTraceName(lang), lang, output)
+}
+
+func stackTraceName(lang string) string {
+	switch lang {
+	case "javascript":
+		return "JavaScript"
+	default:
+		return strings.ToUpper(lang[:1]) + lang[1:]
+	}
+}
+
+// diagnoseMiddleware sends the output piped in with --diagnose as the output
+// to diagnose. It runs before the prompt given as arguments is added, which
+// describes what the user was doing.
+func (m *Mods) diagnoseMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		i := lastUserMessage(messages)
+		if cfg.roleName() != "diagnose" || len(m.steps) > 0 || i < 0 {
+			return messages, nil
+		}
+		if strings.TrimSpace(messages[i].Content) == "" {
+			return nil, modsError{
+				reason: "There's nothing to diagnose.",
+				err:    withExitCode(errors.New("pipe the output of the command in, with its errors, like somecmd 2>&1 | mods --diagnose"), exitConfig),
+			}
+		}
+		messages[i].Content = diagnosis(messages[i].Content)
+		return messages, nil
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"math/rand"
 	"regexp"
+	"strings"
 )
 
 var examples = map[string]string{
@@ -20,6 +21,26 @@ func randomExample() (string, string) {
 	return desc, examples[desc]
 }
 
+// extractCode returns the content of the first code block of the text, or
+// the whole text if it has none.
+func extractCode(text string) string {
+	m := regexp.MustCompile("(?s)```[^\n`]*\n(.*?)\n?```").FindStringSubmatch(text)
+	if m == nil {
+		return strings.TrimSpace(text)
+	}
+	return m[1]
+}
+
+// highlightFlags styles the command line flags found in the text.
+func highlightFlags(s styles, text string) string {
+	return regexp.
+		MustCompile(`(^|[\s("'\x60])(--?[A-Za-z0-9][\w-]*)`).
+		ReplaceAllStringFunc(text, func(x string) string {
+			i := strings.Index(x, "-")
+			return x[:i] + s.flag.Render(x[i:])
+		})
+}
+
 func cheapHighlighting(s styles, code string) string {
 	code = regexp.
 		MustCompile(`"([^"\\]|\\.)*"`).
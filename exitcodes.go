@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Exit codes, by category of failure.
+const (
+	exitError     = 1
+	exitConfig    = 2
+	exitAuth      = 3
+	exitRateLimit = 4
+	exitTimeout   = 5
+	exitCancelled = 6
+	exitRefused   = 7
+)
+
+// exitCodeTypes names the exit codes in the errors printed with
+// --error-format json.
+var exitCodeTypes = map[int]string{
+	exitError:     "error",
+	exitConfig:    "config",
+	exitAuth:      "auth",
+	exitRateLimit: "rate_limit",
+	exitTimeout:   "timeout",
+	exitCancelled: "cancelled",
+	exitRefused:   "refused",
+}
+
+// refusalError returns an error if the model declined to answer, or if the
+// content filter of the provider stopped the response.
+func refusalError(out completionOutput) *modsError {
+	switch {
+	case out.refusal != "":
+		return &modsError{withExitCode(errors.New(out.refusal), exitRefused), "The model refused to answer."}
+	case out.finishReason == "content_filter":
+		err := errors.New("The content filter of the provider stopped the response, rephrasing the prompt may help.")
+		if out.content != "" {
+			err = fmt.Errorf("%w The partial response was: %s", err, out.content)
+		}
+		return &modsError{withExitCode(err, exitRefused), "The response was blocked by a content filter."}
+	}
+	return nil
+}
+
+// codedError marks an error with the exit code of its category, when it
+// can't be told from the error itself.
+type codedError struct {
+	err  error
+	code int
+}
+
+func (e codedError) Error() string { return e.err.Error() }
+func (e codedError) Unwrap() error { return e.err }
+
+func withExitCode(err error, code int) error {
+	return codedError{err, code}
+}
+
+// exitCode returns the exit code matching the category of the error.
+func exitCode(err error) int {
+	var ce codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	status := 0
+	ae := &openai.APIError{}
+	re := &openai.RequestError{}
+	be := &bedrockError{}
+	he := &httpStatusError{}
+	switch {
+	case errors.As(err, &he):
+		status = he.HTTPStatusCode
+	case errors.As(err, &ae):
+		status = ae.HTTPStatusCode
+	case errors.As(err, &re):
+		status = re.HTTPStatusCode
+	case errors.As(err, &be):
+		status = be.HTTPStatusCode
+	}
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return exitAuth
+	case http.StatusTooManyRequests:
+		return exitRateLimit
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return exitTimeout
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return exitTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return exitCancelled
+	}
+	return exitError
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[a-zA-Z]")
+
+// plainError removes the styles and padding of the inline code in error
+// messages.
+func plainError(s string) string {
+	return strings.Join(strings.Fields(ansiEscape.ReplaceAllString(s, "")), " ")
+}
+
+// printError prints the error, styled on stdout by default, or as a JSON
+// object on stderr with --error-format json.
+func (m Mods) printError() {
+	if m.Config.ErrorFormat != "json" {
+		fmt.Println(m.ErrorView())
+		return
+	}
+	code := exitCode(m.Error.err)
+	var v struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Details string `json:"details,omitempty"`
+			Code    int    `json:"code"`
+		} `json:"error"`
+	}
+	v.Error.Type = exitCodeTypes[code]
+	v.Error.Message = plainError(m.Error.reason)
+	v.Error.Details = plainError(m.Error.Error())
+	v.Error.Code = code
+	b, _ := json.Marshal(v)
+	fmt.Fprintln(os.Stderr, string(b))
+}
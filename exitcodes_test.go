@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRefusalError(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     completionOutput
+		reason  string
+		message string
+	}{
+		{
+			name:    "content filter",
+			out:     completionOutput{finishReason: "content_filter"},
+			reason:  "The response was blocked by a content filter.",
+			message: "The content filter of the provider stopped the response, rephrasing the prompt may help.",
+		},
+		{
+			name:    "content filter with a partial response",
+			out:     completionOutput{finishReason: "content_filter", content: "Once upon"},
+			reason:  "The response was blocked by a content filter.",
+			message: "The content filter of the provider stopped the response, rephrasing the prompt may help. The partial response was: Once upon",
+		},
+		{
+			name:    "refusal",
+			out:     completionOutput{refusal: "I can't help with that.", finishReason: "stop"},
+			reason:  "The model refused to answer.",
+			message: "I can't help with that.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := refusalError(tt.out)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.reason != tt.reason {
+				t.Errorf("got reason %q, want %q", err.reason, tt.reason)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("got message %q, want %q", err.Error(), tt.message)
+			}
+			if code := exitCode(err.err); code != exitRefused {
+				t.Errorf("got exit code %d, want %d", code, exitRefused)
+			}
+			if typ := exitCodeTypes[exitCode(err.err)]; typ != "refused" {
+				t.Errorf("got type %q, want refused", typ)
+			}
+		})
+	}
+}
+
+func TestRefusalErrorNone(t *testing.T) {
+	for _, reason := range []string{"stop", "length", "tool_calls", ""} {
+		if err := refusalError(completionOutput{finishReason: reason, content: "hi"}); err != nil {
+			t.Errorf("finish reason %q: unexpected error %v", reason, err)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain", errors.New("boom"), exitError},
+		{"coded", withExitCode(errors.New("bad setting"), exitConfig), exitConfig},
+		{"wrapped coded", fmt.Errorf("loading: %w", withExitCode(errors.New("nope"), exitRefused)), exitRefused},
+		{"unauthorized", &openai.APIError{HTTPStatusCode: http.StatusUnauthorized}, exitAuth},
+		{"forbidden", &openai.RequestError{HTTPStatusCode: http.StatusForbidden}, exitAuth},
+		{"rate limit", &httpStatusError{HTTPStatusCode: http.StatusTooManyRequests}, exitRateLimit},
+		{"gateway timeout", &openai.APIError{HTTPStatusCode: http.StatusGatewayTimeout}, exitTimeout},
+		{"server error", &openai.APIError{HTTPStatusCode: http.StatusInternalServerError}, exitError},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), exitTimeout},
+		{"cancelled", context.Canceled, exitCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainError(t *testing.T) {
+	in := "Run \x1b[38;5;212m mods --chat \x1b[0m  from a terminal."
+	if got, want := plainError(in), "Run mods --chat from a terminal."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
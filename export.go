@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// backupVersion is the version of the --export-all format, to be increased
+// with incompatible changes so older backups can still be imported.
+const backupVersion = 1
+
+// exportConversations writes all the saved conversations to a backup file
+// that --import can restore, returning how many were exported.
+// Conversations are written one at a time rather than loaded all at once.
+func exportConversations(path string) (int, error) {
+	ids, err := conversationIDs()
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	w := bufio.NewWriter(f)
+	if _, err := fmt.Fprintf(w, `{"version":%d,"conversations":[`, backupVersion); err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	n := 0
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", id, err)
+		}
+		if n > 0 {
+			if _, err := w.WriteString(","); err != nil {
+				return n, err
+			}
+		}
+		if err := enc.Encode(c); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if _, err := w.WriteString("]}\n"); err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
+
+// importBackup restores the conversations of an --export-all backup, the
+// decoder being positioned after its opening brace.
+func importBackup(dec *json.Decoder) (int, error) {
+	n := 0
+	version := 0
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+		switch t {
+		case "version":
+			if err := dec.Decode(&version); err != nil {
+				return n, err
+			}
+			if version > backupVersion {
+				return n, fmt.Errorf("the backup was made by a newer version of mods (format %d)", version)
+			}
+		case "conversations":
+			if version == 0 {
+				return n, fmt.Errorf("the backup has no version")
+			}
+			if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+				return n, fmt.Errorf("expected a list of conversations")
+			}
+			for dec.More() {
+				var c conversation
+				if err := dec.Decode(&c); err != nil {
+					return n, err
+				}
+				if _, err := writeConversation(c); err != nil {
+					return n, err
+				}
+				n++
+			}
+			if _, err := dec.Token(); err != nil {
+				return n, err
+			}
+		default:
+			// Skip fields added by later versions.
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func exportNotice(n int, path string) string {
+	if n == 1 {
+		return fmt.Sprintf("Exported 1 conversation to %s.", path)
+	}
+	return fmt.Sprintf("Exported %d conversations to %s.", n, path)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	openai "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// messageFlag is a repeatable flag adding a message with its role to the
+// shared list, so --user and --assistant keep the order they're given in.
+type messageFlag struct {
+	role     string
+	messages *[]openai.ChatCompletionMessage
+}
+
+func (f messageFlag) String() string { return "" }
+
+func (f messageFlag) Set(s string) error {
+	*f.messages = append(*f.messages, openai.ChatCompletionMessage{Role: f.role, Content: s})
+	return nil
+}
+
+func (f messageFlag) Type() string { return "string" }
+
+// seedWarning returns a warning if the messages, followed by the prompt,
+// don't alternate between the user and the assistant.
+func seedWarning(messages []openai.ChatCompletionMessage) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	last := ""
+	for _, msg := range append(messages, userMessage("")) {
+		if msg.Role == last {
+			return "The example messages, followed by the prompt, don't alternate between the user and the assistant. Some models may reject or misread them."
+		}
+		last = msg.Role
+	}
+	return ""
+}
+
+// loadExamples reads the messages of the --examples file, a list of
+// messages with their role and content:
+//
+//   - role: user
+//     content: France
+//   - role: assistant
+//     content: Paris
+func loadExamples(path string) ([]openai.ChatCompletionMessage, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		Role    string `yaml:"role"`
+		Content string `yaml:"content"`
+	}
+	if err := yaml.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(entries))
+	for i, e := range entries {
+		if e.Role != openai.ChatMessageRoleUser && e.Role != openai.ChatMessageRoleAssistant {
+			return nil, fmt.Errorf("%s: example %d has the role %q, expected user or assistant", path, i+1, e.Role)
+		}
+		if e.Content == "" {
+			return nil, fmt.Errorf("%s: example %d has no content", path, i+1)
+		}
+		messages = append(messages, openai.ChatCompletionMessage{Role: e.Role, Content: e.Content})
+	}
+	return messages, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// fifoRetryInterval is how often the named pipe of --fifo is opened
+	// again while there's no reader.
+	fifoRetryInterval = 100 * time.Millisecond
+	// fifoFlushTimeout is how long mods waits on exit for the reader of the
+	// named pipe to read the rest of the response.
+	fifoFlushTimeout = 2 * time.Second
+)
+
+// fifoWriter writes the response to the named pipe of --fifo as it's
+// generated. The pipe is opened once a reader shows up; what was generated by
+// then is written first. Writing happens in the background so a slow or
+// missing reader never holds up mods.
+type fifoWriter struct {
+	path   string
+	mu     sync.Mutex
+	buf    strings.Builder
+	closed bool
+	more   chan struct{}
+	done   chan struct{}
+}
+
+// openFIFO starts writing to the named pipe at the path, which has to exist.
+func openFIFO(path string) (*fifoWriter, error) {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s doesn't exist, create it with mkfifo %s", path, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("%s isn't a named pipe", path)
+	}
+	w := &fifoWriter{
+		path: path,
+		more: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// write queues the text to be written to the pipe.
+func (w *fifoWriter) write(s string) {
+	w.mu.Lock()
+	w.buf.WriteString(s)
+	w.mu.Unlock()
+	w.signal()
+}
+
+// close stops the writing once the queued text is written, and waits for it
+// at most fifoFlushTimeout.
+func (w *fifoWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.signal()
+	select {
+	case <-w.done:
+	case <-time.After(fifoFlushTimeout):
+	}
+}
+
+// buffered returns the size of the text waiting for the reader.
+func (w *fifoWriter) buffered() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return int64(w.buf.Len())
+}
+
+func (w *fifoWriter) signal() {
+	select {
+	case w.more <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued text, and whether the writer was closed.
+func (w *fifoWriter) take() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.buf.String()
+	w.buf.Reset()
+	return s, w.closed
+}
+
+func (w *fifoWriter) run() {
+	defer close(w.done)
+	f := w.waitForReader()
+	if f == nil {
+		return
+	}
+	defer f.Close() //nolint:errcheck
+	for {
+		s, closed := w.take()
+		if s != "" {
+			if _, err := f.WriteString(s); err != nil {
+				// The reader went away.
+				return
+			}
+		}
+		if closed {
+			return
+		}
+		<-w.more
+	}
+}
+
+// waitForReader opens the pipe once there's a reader, or returns nil if the
+// writer is closed first. Opening a pipe without a reader only fails when it
+// doesn't block; once it succeeds, the pipe is opened again to block on
+// writes, before closing the first one so the reader doesn't see the end.
+func (w *fifoWriter) waitForReader() *os.File {
+	for {
+		probe, err := os.OpenFile(w.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			f, err := os.OpenFile(w.path, os.O_WRONLY, 0)
+			_ = probe.Close()
+			if err == nil {
+				return f
+			}
+		}
+		w.mu.Lock()
+		closed := w.closed
+		w.mu.Unlock()
+		if closed {
+			return nil
+		}
+		time.Sleep(fifoRetryInterval)
+	}
+}
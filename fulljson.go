@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// formatFlag is the value of --format: a boolean turning on Markdown
+// formatting, like it always was, full-json to print the response as a JSON
+// object, or json to print the steps of --steps as a JSON array.
+type formatFlag struct {
+	markdown *bool
+	output   *string
+}
+
+func (f formatFlag) String() string {
+	if *f.output != "" {
+		return *f.output
+	}
+	return strconv.FormatBool(*f.markdown)
+}
+
+func (f formatFlag) Set(s string) error {
+	if s == "full-json" || s == "json" {
+		*f.output = s
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("expected true, false, json or full-json")
+	}
+	*f.markdown = b
+	return nil
+}
+
+func (f formatFlag) Type() string { return "format" }
+
+// fullJSON is the response printed with --format=full-json.
+type fullJSON struct {
+	Model           string `json:"model"`
+	ContentRaw      string `json:"content_raw"`
+	ContentRendered string `json:"content_rendered"`
+	Usage           struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// printFullJSON prints the response, as is and as it would be shown, with
+// its model, usage and finish reason. The rendered content is plain text
+// unless --ansi is set.
+func (m *Mods) printFullJSON() error {
+	var v fullJSON
+	v.Model = m.Config.Model
+	v.ContentRaw = m.Output
+	v.ContentRendered = m.FormattedOutput()
+	if m.Config.ANSI {
+		r := lipgloss.NewRenderer(os.Stdout)
+		r.SetColorProfile(termenv.ANSI256)
+		v.ContentRendered = styleMarkdown(makeStyles(r), v.ContentRendered, m.Config.CodeStyle)
+	}
+	v.Usage.PromptTokens = m.usage.prompt
+	v.Usage.CompletionTokens = m.usage.completion
+	v.FinishReason = m.finishReason
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// gitContext returns the status of the git repository of the working
+// directory, and its staged changes if diff is set, to send as context.
+func gitContext(diff bool) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", errors.New("git isn't installed, --git-context needs it")
+	}
+	if _, err := runGit("rev-parse", "--is-inside-work-tree"); err != nil {
+		return "", errors.New("not in a git repository, run mods from one to use --git-context")
+	}
+	status, err := runGit("status", "--short")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if status == "" {
+		status = "nothing to commit, working tree clean"
+	}
+	fmt.Fprintf(&b, "Git status:\n\n```\n%s\n```", status)
+	if diff {
+		staged, err := runGit("diff", "--staged")
+		if err != nil {
+			return "", err
+		}
+		if staged != "" {
+			fmt.Fprintf(&b, "\n\nStaged changes:\n\n```diff\n%s\n```", staged)
+		}
+	}
+	return b.String(), nil
+}
+
+func runGit(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// gitContextMiddleware adds the git status, and the staged changes, after
+// the first message sent with --git-context.
+func (m *Mods) gitContextMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		i := lastUserMessage(messages)
+		if !cfg.GitContext || len(m.steps) > 0 || i < 0 {
+			return messages, nil
+		}
+		ctx, err := gitContext(cfg.GitDiff)
+		if err != nil {
+			return nil, modsError{withExitCode(err, exitConfig), "Unable to read the git context."}
+		}
+		messages[i].Content = strings.TrimSpace(messages[i].Content + "\n\n" + ctx)
+		return messages, nil
+	}
+}
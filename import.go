@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chatGPTConversation is a conversation of a ChatGPT data export, as found in
+// its conversations.json file. Messages form a tree, as editing a message or
+// regenerating a response creates a new branch.
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	UpdateTime     float64                `json:"update_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Model          string                 `json:"default_model_slug"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		Content struct {
+			ContentType string `json:"content_type"`
+			Parts       []any  `json:"parts"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// importConversations adds the conversations of a ChatGPT export or of an
+// --export-all backup to the conversations directory and returns how many
+// were imported. Importing the same file again overwrites the conversations
+// imported before.
+func importConversations(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := json.NewDecoder(f)
+	switch t, _ := dec.Token(); t {
+	case json.Delim('['):
+		return importChatGPT(dec)
+	case json.Delim('{'):
+		return importBackup(dec)
+	default:
+		return 0, errors.New("expected a mods backup or the conversations.json file of a ChatGPT export")
+	}
+}
+
+// importChatGPT imports the conversations of a ChatGPT export, the decoder
+// being positioned after its opening bracket.
+func importChatGPT(dec *json.Decoder) (int, error) {
+	n := 0
+	for dec.More() {
+		var gc chatGPTConversation
+		if err := dec.Decode(&gc); err != nil {
+			return n, err
+		}
+		c := gc.conversation()
+		if len(c.Messages) == 0 {
+			continue
+		}
+		if _, err := writeConversation(c); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (gc chatGPTConversation) conversation() conversation {
+	id := gc.ConversationID
+	if id == "" {
+		id = gc.ID
+	}
+	model := gc.Model
+	if model == "" {
+		model = "chatgpt"
+	}
+	return conversation{
+		ID:        "chatgpt-" + id,
+		Title:     gc.Title,
+		Model:     model,
+		CreatedAt: unixTime(gc.CreateTime),
+		UpdatedAt: unixTime(gc.UpdateTime),
+		Messages:  gc.messages(),
+	}
+}
+
+// messages returns the messages of the branch leading to the current node,
+// which is the one shown in ChatGPT.
+func (gc chatGPTConversation) messages() []openai.ChatCompletionMessage {
+	var messages []openai.ChatCompletionMessage
+	seen := map[string]bool{}
+	for id := gc.CurrentNode; id != "" && !seen[id]; id = gc.Mapping[id].Parent {
+		seen[id] = true
+		msg := gc.Mapping[id].Message
+		if msg == nil || msg.Content.ContentType != "text" {
+			continue
+		}
+		var parts []string
+		for _, p := range msg.Content.Parts {
+			if s, ok := p.(string); ok && s != "" {
+				parts = append(parts, s)
+			}
+		}
+		content := strings.Join(parts, "\n")
+		if content == "" {
+			continue
+		}
+		switch msg.Author.Role {
+		case openai.ChatMessageRoleUser:
+			messages = append(messages, userMessage(content))
+		case openai.ChatMessageRoleAssistant:
+			messages = append(messages, assistantMessage(content))
+		}
+	}
+	// The branch was walked from the last message up.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+func unixTime(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+func importNotice(n int, path string) string {
+	if n == 1 {
+		return fmt.Sprintf("Imported 1 conversation from %s.", path)
+	}
+	return fmt.Sprintf("Imported %d conversations from %s.", n, path)
+}
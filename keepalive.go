@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// keepaliveTick is a tea.Msg sent every keepalive-interval while mods runs.
+type keepaliveTick struct{}
+
+// keepaliveCmd starts the keepalive ticks, when an interval is set and the
+// spinner, which keeps the terminal busy otherwise, is hidden by --quiet or
+// stopped by --no-animation.
+func (m *Mods) keepaliveCmd() tea.Cmd {
+	if m.Config.KeepaliveInterval <= 0 || !(m.Config.Quiet || m.Config.NoAnimation) || !isatty.IsTerminal(os.Stderr.Fd()) {
+		return nil
+	}
+	return tea.Tick(m.Config.KeepaliveInterval, func(time.Time) tea.Msg {
+		return keepaliveTick{}
+	})
+}
+
+// keepalive writes a NUL byte, which terminals don't show, to stderr while
+// the response is generated, so idle SSH sessions aren't dropped.
+func (m *Mods) keepalive() tea.Cmd {
+	if m.state == completionState {
+		_, _ = os.Stderr.Write([]byte{0})
+	}
+	return m.keepaliveCmd()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+)
+
+func lastResponsesPath() (string, error) {
+	return xdg.DataFile(filepath.Join("mods", "last_responses.json"))
+}
+
+func loadLastResponses() ([]string, error) {
+	path, err := lastResponsesPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var responses []string
+	return responses, json.Unmarshal(b, &responses)
+}
+
+// saveLastResponse adds the response to the ones kept for --last, dropping
+// the oldest ones past the limit.
+func saveLastResponse(response string, limit int) error {
+	if limit <= 0 || response == "" {
+		return nil
+	}
+	responses, err := loadLastResponses()
+	if err != nil {
+		// Start over rather than failing on a corrupted file.
+		responses = nil
+	}
+	responses = append(responses, response)
+	if len(responses) > limit {
+		responses = responses[len(responses)-limit:]
+	}
+	b, err := json.Marshal(responses)
+	if err != nil {
+		return err
+	}
+	path, err := lastResponsesPath()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600) //nolint:gomnd
+}
+
+// lastResponse returns the nth most recent response, starting at 1.
+func lastResponse(n int) (string, error) {
+	responses, err := loadLastResponses()
+	if err != nil {
+		return "", err
+	}
+	if n < 1 || n > len(responses) {
+		return "", fmt.Errorf("There are %d saved responses.", len(responses))
+	}
+	return responses[len(responses)-n], nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// printRaw prints the raw response, or its code, followed by a line break,
+// with the line endings of --line-endings.
+func printRaw(out string, cfg config) {
+	fmt.Print(withLineEndings(out+"\n", cfg.LineEndings))
+}
+
+// withLineEndings converts the line endings of the text to lf, crlf, or the
+// native ones of the system: crlf on Windows and lf elsewhere.
+func withLineEndings(s, endings string) string {
+	if endings == "native" && runtime.GOOS == "windows" {
+		endings = "crlf"
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if endings == "crlf" {
+		s = strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSince returns the start of the window given to --since: a number of
+// days, weeks or hours ago like 7d, 2w or 12h, any Go duration, or a date
+// like 2024-01-01.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,     //nolint:gomnd
+		"w": 7 * 24 * time.Hour, //nolint:gomnd
+	}
+	for suffix, unit := range units {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); err == nil && strings.HasSuffix(s, suffix) && n >= 0 {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration like 7d, 2w or 12h, or a date like 2024-01-01", s)
+}
+
+// listConversations returns the saved conversations updated since the given
+// time, the most recent first.
+func listConversations(since time.Time) ([]conversation, error) {
+	ids, err := conversationIDs()
+	if err != nil {
+		return nil, err
+	}
+	var list []conversation
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err != nil || c.UpdatedAt.Before(since) {
+			continue
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+	return list, nil
+}
+
+// printConversations prints a line about each saved conversation, or a JSON
+// document with --json.
+func printConversations(cfg config, s styles) error {
+	var since time.Time
+	if cfg.Since != "" {
+		var err error
+		if since, err = parseSince(cfg.Since, time.Now()); err != nil {
+			return withExitCode(err, exitConfig)
+		}
+	}
+	list, err := listConversations(since)
+	if err != nil {
+		return err
+	}
+	if cfg.JSON {
+		type entry struct {
+			ID        string    `json:"id"`
+			Title     string    `json:"title,omitempty"`
+			Pinned    bool      `json:"pinned,omitempty"`
+			Model     string    `json:"model"`
+			Messages  int       `json:"messages"`
+			CreatedAt time.Time `json:"created_at"`
+			UpdatedAt time.Time `json:"updated_at"`
+		}
+		entries := make([]entry, 0, len(list))
+		for _, c := range list {
+			entries = append(entries, entry{c.ID, c.Title, c.Pinned, c.Model, len(c.Messages), c.CreatedAt, c.UpdatedAt})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(os.Stderr, s.comment.Render("No conversations found."))
+		return nil
+	}
+	for _, c := range list {
+		line := conversationSummary(c)
+		if c.Pinned {
+			line += s.comment.Render(" · pinned")
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxLogitBias = 100
+
+// parseLogitBias parses the token:bias pairs given to --logit-bias into the
+// logit_bias request parameter. A token that isn't an ID is text, whose
+// tokens with the tokenizer of the model all get the bias.
+func parseLogitBias(model string, pairs []string) (map[string]int, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	bias := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid logit bias %q, expected token:bias", pair)
+		}
+		token, value := pair[:i], pair[i+1:]
+		b, err := strconv.Atoi(value)
+		if err != nil || b < -maxLogitBias || b > maxLogitBias {
+			return nil, fmt.Errorf("invalid bias %q for token %s, expected a number from -%d to %d", value, token, maxLogitBias, maxLogitBias)
+		}
+		ids, err := logitBiasTokens(model, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			bias[id] = b
+		}
+	}
+	return bias, nil
+}
+
+// logitBiasTokens returns the token IDs of the token of a logit bias, either
+// an ID or text to tokenize.
+func logitBiasTokens(model, token string) ([]string, error) {
+	if _, err := strconv.ParseUint(token, 10, 32); err == nil {
+		return []string{token}, nil
+	}
+	if token == "" {
+		return nil, errors.New("invalid logit bias, the token is empty")
+	}
+	enc, exact, err := tokenizer(model)
+	if err != nil {
+		return nil, err
+	}
+	if !exact {
+		// The IDs of another tokenizer would bias other tokens.
+		return nil, fmt.Errorf("the tokenizer of %s isn't known, give the token IDs of %q instead", model, token)
+	}
+	var ids []string
+	for _, id := range enc.EncodeOrdinary(token) {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return ids, nil
+}
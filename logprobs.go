@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// formatLogprobs returns the list of tokens and their probabilities to add
+// after a response.
+func formatLogprobs(logprobs []tokenLogprob) string {
+	if len(logprobs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nLogprobs:")
+	for _, lp := range logprobs {
+		fmt.Fprintf(&b, "\n%q %s", lp.Token, formatProbability(lp.Logprob))
+		if len(lp.TopLogprobs) == 0 {
+			continue
+		}
+		alts := make([]string, 0, len(lp.TopLogprobs))
+		for _, top := range lp.TopLogprobs {
+			alts = append(alts, fmt.Sprintf("%q %s", top.Token, formatProbability(top.Logprob)))
+		}
+		fmt.Fprintf(&b, " (%s)", strings.Join(alts, ", "))
+	}
+	return b.String()
+}
+
+func formatProbability(logprob float64) string {
+	return fmt.Sprintf("%.2f%%", math.Exp(logprob)*100) //nolint:gomnd
+}
+
+// logprobsJSON returns the tokens of the response with their log
+// probabilities and probabilities as JSON.
+func logprobsJSON(logprobs []tokenLogprob) (string, error) {
+	b, err := json.MarshalIndent(withProbabilities(logprobs), "", "  ")
+	return string(b), err
+}
+
+func withProbabilities(logprobs []tokenLogprob) []tokenLogprob {
+	out := make([]tokenLogprob, 0, len(logprobs))
+	for _, lp := range logprobs {
+		lp.Probability = math.Exp(lp.Logprob)
+		lp.TopLogprobs = withProbabilities(lp.TopLogprobs)
+		out = append(out, lp)
+	}
+	return out
+}
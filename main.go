@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime/debug"
+	"strings"
 
+	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glow/editor"
 	"github.com/charmbracelet/lipgloss"
@@ -29,6 +32,7 @@ type styles struct {
 	cyclingChars lipgloss.Style
 	errorHeader  lipgloss.Style
 	errorDetails lipgloss.Style
+	failed       lipgloss.Style
 	flag         lipgloss.Style
 	flagComma    lipgloss.Style
 	flagDesc     lipgloss.Style
@@ -36,6 +40,7 @@ type styles struct {
 	link         lipgloss.Style
 	pipe         lipgloss.Style
 	quote        lipgloss.Style
+	truncated    lipgloss.Style
 }
 
 func makeStyles(r *lipgloss.Renderer) (s styles) {
@@ -45,6 +50,7 @@ func makeStyles(r *lipgloss.Renderer) (s styles) {
 	s.cyclingChars = r.NewStyle().Foreground(lipgloss.Color("#FF87D7"))
 	s.errorHeader = r.NewStyle().Foreground(lipgloss.Color("#F1F1F1")).Background(lipgloss.Color("#FF5F87")).Bold(true).Padding(0, 1).SetString("ERROR")
 	s.errorDetails = s.comment.Copy()
+	s.failed = r.NewStyle().Foreground(lipgloss.Color("#FF5F87")).Bold(true)
 	s.flag = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#00B594", Dark: "#3EEFCF"}).Bold(true)
 	s.flagComma = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#5DD6C0", Dark: "#427C72"}).SetString(",")
 	s.flagDesc = s.comment.Copy()
@@ -52,6 +58,7 @@ func makeStyles(r *lipgloss.Renderer) (s styles) {
 	s.link = r.NewStyle().Foreground(lipgloss.Color("#00AF87")).Underline(true)
 	s.quote = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#FF71D0", Dark: "#FF78D2"})
 	s.pipe = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#8470FF", Dark: "#745CFF"})
+	s.truncated = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#D75F00", Dark: "#FFAF5F"}).Italic(true)
 	return s
 }
 
@@ -75,10 +82,16 @@ func buildVersion() string {
 func main() {
 	renderer := lipgloss.NewRenderer(os.Stderr, termenv.WithColorCache(true))
 	opts := []tea.ProgramOption{tea.WithOutput(renderer.Output())}
-	if !isatty.IsTerminal(os.Stdin.Fd()) {
-		opts = append(opts, tea.WithInput(nil))
-	}
 	mods := newMods(renderer)
+	mods.terminal = isatty.IsTerminal(os.Stdin.Fd())
+	if !mods.terminal {
+		// The piped prompt is read from stdin, and the keys from the terminal.
+		if mods.terminal = terminalInput(); mods.terminal {
+			opts = append(opts, tea.WithInputTTY())
+		} else {
+			opts = append(opts, tea.WithInput(nil))
+		}
+	}
 	p := tea.NewProgram(mods, opts...)
 	m, err := p.Run()
 	if err != nil {
@@ -86,8 +99,29 @@ func main() {
 		os.Exit(1)
 	}
 	mods = m.(*Mods)
+	if mods.fifo != nil {
+		mods.fifo.close()
+	}
+	if mods.Config.HistoryFile != "" && !mods.Config.NoHistory && !mods.started.IsZero() {
+		if err := mods.logPrompt(); err != nil {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Unable to log the prompt to the history-file: "+err.Error()))
+		}
+	}
+	if mods.Config.settingsNotice != "" {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(mods.Config.settingsNotice))
+	}
+	if mods.Config.Verbose && mods.Config.rememberNotice != "" {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(mods.Config.rememberNotice))
+	}
 	if mods.Error != nil {
-		os.Exit(1)
+		if mods.Config.ErrorFormat == "json" {
+			mods.printError()
+		}
+		mods.exportTrace(*mods.Error)
+		os.Exit(exitCode(mods.Error.err))
+	}
+	if mods.aborted && !mods.Config.Chat {
+		os.Exit(exitCancelled)
 	}
 	if mods.Config.Settings {
 		c := editor.Cmd(mods.Config.SettingsPath)
@@ -96,7 +130,19 @@ func main() {
 		c.Stderr = os.Stderr
 		if err := c.Run(); err != nil {
 			mods.Error = &modsError{reason: "Missing $EDITOR", err: err}
-			fmt.Println(mods.ErrorView())
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println("Wrote config file to:", mods.Config.SettingsPath)
+		os.Exit(0)
+	}
+	if mods.Config.EditConfig {
+		if err := editConfig(mods.Config.SettingsPath); err != nil {
+			mods.Error = &modsError{reason: "There was an error in your config file.", err: err}
+			if ee := (*editorError)(nil); errors.As(err, &ee) {
+				mods.Error.reason = "Unable to open your $EDITOR."
+			}
+			mods.printError()
 			os.Exit(1)
 		}
 		fmt.Println("Wrote config file to:", mods.Config.SettingsPath)
@@ -106,9 +152,357 @@ func main() {
 		fmt.Println(buildVersion())
 		os.Exit(0)
 	}
-	if mods.Config.ShowHelp || (mods.Input == "" && mods.Config.Prefix == "") {
+	if api := mods.Config.SetDefaultAPI; api != "" {
+		if _, ok := mods.Config.APIs[api]; !ok {
+			err := mods.unknownAPIError(api)
+			mods.Error = &err
+			mods.printError()
+			os.Exit(1)
+		}
+		if err := saveDefaultAPI(mods.Config.SettingsPath, api); err != nil {
+			mods.Error = &modsError{reason: "Unable to save the default API.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println("Default API set to", api, "in:", mods.Config.SettingsPath)
+		os.Exit(0)
+	}
+	if mods.Config.ListRoles {
+		listRoles(mods.Config, mods.styles)
+		os.Exit(0)
+	}
+	if mods.Config.ListAPIs {
+		if err := listAPIs(mods.Config, mods.styles, mods.Config.JSON); err != nil {
+			mods.Error = &modsError{reason: "Unable to list the APIs.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if mods.Config.Ping {
+		if _, ok := mods.Config.APIs[mods.Config.API]; mods.Config.API != "" && !ok {
+			err := mods.unknownAPIError(mods.Config.API)
+			mods.Error = &err
+			mods.printError()
+			os.Exit(1)
+		}
+		results := pingAPIs(mods.Config)
+		if err := printPings(results, mods.styles, mods.Config.JSON); err != nil {
+			mods.Error = &modsError{reason: "Unable to print the results.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		for _, r := range results {
+			if !r.OK {
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	if path := mods.Config.Import; path != "" {
+		n, err := importConversations(path)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to import the conversations.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println(importNotice(n, path))
+		os.Exit(0)
+	}
+	if path := mods.Config.ExportAll; path != "" {
+		n, err := exportConversations(path)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to export the conversations.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println(exportNotice(n, path))
+		os.Exit(0)
+	}
+	if mods.Config.List {
+		if err := printConversations(mods.Config, mods.styles); err != nil {
+			mods.Error = &modsError{reason: "Unable to list the conversations.", err: err}
+			mods.printError()
+			os.Exit(exitCode(err))
+		}
+		os.Exit(0)
+	}
+	if s := mods.Config.Rename; s != "" {
+		title := strings.TrimSpace(mods.Config.Prefix)
+		if title == "" {
+			mods.Error = &modsError{
+				reason: "Missing the new title.",
+				err:    fmt.Errorf("Give it as arguments: %s", mods.styles.inlineCode.Render(`mods --rename "old title" "new title"`)),
+			}
+			mods.printError()
+			os.Exit(exitConfig)
+		}
+		c, err := renameConversation(s, title, mods.Config.Overwrite)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to rename the conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Printf("Renamed conversation %s to %q.\n", c.ID, c.Title)
+		os.Exit(0)
+	}
+	if mods.Config.ScratchReset {
+		ok, err := resetScratch()
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to clear the scratch conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Println("The scratch conversation is already empty.")
+			os.Exit(0)
+		}
+		fmt.Println("Cleared the scratch conversation.")
+		os.Exit(0)
+	}
+	if mods.Config.Pin != "" || mods.Config.Unpin != "" {
+		s, pinned, verb := mods.Config.Pin, true, "Pinned"
+		if s == "" {
+			s, pinned, verb = mods.Config.Unpin, false, "Unpinned"
+		}
+		c, err := pinConversation(s, pinned)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to update the conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println(verb, "conversation", c.ID+".")
+		os.Exit(0)
+	}
+	if mods.Config.Delete != "" {
+		c, err := deleteConversation(mods.Config.Delete)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to delete the conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println("Deleted conversation", c.ID+".")
+		os.Exit(0)
+	}
+	if mods.Config.Replay != "" || mods.Config.ReplayLast {
+		c, err := mods.Config.replayConversation()
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to find the conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		printOutput(formatTranscript(makeStyles(lipgloss.NewRenderer(os.Stdout)), c, mods.Config.ShowReasoning), mods.Config)
+		os.Exit(0)
+	}
+	if mods.Config.PrintConfig {
+		b, err := mods.Config.resolvedSettings(mods.Config.ShowSecrets)
+		if err != nil {
+			mods.Error = &modsError{reason: "There was an error in your config file.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Print(string(b))
+		os.Exit(0)
+	}
+	if mods.Config.ShowSystem {
+		system, err := mods.systemMessage(mods.Config)
+		if err != nil {
+			// The middlewares return their errors as a modsError.
+			var me modsError
+			errors.As(err, &me)
+			mods.Error = &me
+			mods.printError()
+			os.Exit(exitCode(me.err))
+		}
+		if system == "" {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("No system prompt is sent."))
+			os.Exit(0)
+		}
+		fmt.Println(system)
+		os.Exit(0)
+	}
+	if n := mods.Config.Last; n > 0 {
+		out, err := lastResponse(n)
+		if err != nil {
+			mods.Error = &modsError{reason: "Unable to find that response.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println(out)
+		os.Exit(0)
+	}
+	if !mods.Config.ShowHelp && mods.Input == "" && mods.Config.Prefix == "" && mods.Config.RawRequest == "" && !mods.Config.GitContext && !isatty.IsTerminal(os.Stdin.Fd()) {
+		mods.Error = &modsError{
+			reason: "No input provided.",
+			err:    fmt.Errorf("The piped input was empty, pipe some content into mods or give it a prompt: %s", mods.styles.inlineCode.Render(`mods "your prompt"`)),
+		}
+		mods.printError()
+		os.Exit(1)
+	}
+	if mods.Config.remembered != nil && !mods.Config.ShowHelp {
+		_ = saveRemembered(*mods.Config.remembered)
+	}
+	if mods.Config.Chat {
+		if len(mods.messages) > 0 && mods.Config.saving() {
+			path, err := mods.saveConversation(true)
+			if err != nil {
+				mods.Error = &modsError{reason: "Unable to save the conversation.", err: err}
+				mods.printError()
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stderr, "Conversation saved to:", path)
+		}
+		if mods.Config.Verbose && len(mods.evicted) > 0 {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render(evictionNotice(mods.evicted)))
+		}
+		os.Exit(0)
+	}
+	if mods.Config.ShowHelp || (mods.Input == "" && mods.Config.Prefix == "" && mods.Config.RawRequest == "" && !mods.Config.GitContext) {
 		flag.Usage()
 		os.Exit(0)
 	}
-	fmt.Println(mods.FormattedOutput())
+	render := mods.trace.startSpan("render", nil)
+	if mods.Config.Commit {
+		mods.Output = commitMessage(mods.Output, mods.Config.CommitSubjectLength)
+	}
+	if mods.Config.RenderMath {
+		mods.Output = renderMath(mods.Output)
+	}
+	if mods.Config.Sentences > 0 {
+		mods.Output = firstSentences(mods.Output, mods.Config.Sentences)
+	}
+	if !mods.Config.PromptOnly {
+		_ = saveLastResponse(mods.Output, mods.Config.LastResponses)
+	}
+	if mods.warning != "" {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(mods.warning))
+	}
+	if mods.Config.Verbose && len(mods.steps) > 0 {
+		fmt.Fprint(os.Stderr, formatSteps(mods.styles, mods.steps))
+	}
+	if mods.Config.Think && mods.Reasoning != "" {
+		fmt.Fprintln(os.Stderr, formatThinking(mods.styles, mods.Reasoning))
+	} else if mods.Reasoning != "" && isatty.IsTerminal(os.Stderr.Fd()) {
+		// Collapsed, the reasoning is only mentioned.
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(reasoningNotice(mods.Reasoning, mods.continued))+"\n")
+	}
+	if mods.continued != nil && mods.Config.ShowContext {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(conversationHeader(*mods.continued))+"\n")
+	}
+	if mods.Config.echo() && !mods.echoed {
+		s := makeStyles(lipgloss.NewRenderer(os.Stdout))
+		fmt.Println(formatUserTurn(s, mods.prompt) + "\n")
+	}
+	if mods.Config.OutputFormat == "full-json" {
+		if err := mods.printFullJSON(); err != nil {
+			mods.Error = &modsError{reason: "Unable to print the response as JSON.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+	} else if mods.Config.OutputFormat == "json" {
+		out, err := stepsJSON(mods.Output)
+		if err != nil {
+			mods.Error = &modsError{reason: "The response isn't a list of steps.", err: err}
+			if mods.Config.LastResponses > 0 {
+				mods.Error.err = fmt.Errorf("%s, the response is still available with %s", err, mods.styles.inlineCode.Render("mods --last"))
+			}
+			mods.printError()
+			os.Exit(1)
+		}
+		fmt.Println(out)
+	} else if mods.Config.As != "" {
+		printRaw(outputAs(mods.Config.As, mods.Output), mods.Config)
+	} else if mods.Config.ExtractCode {
+		printRaw(extractCode(mods.Output), mods.Config)
+	} else if r := mods.Config.Renderer; r != "" {
+		if err := renderOutput(r, mods.FormattedOutput()); err != nil {
+			mods.Error = &modsError{reason: "Unable to render the response with " + mods.styles.inlineCode.Render(r) + ".", err: err}
+			if mods.Config.LastResponses > 0 {
+				mods.Error.err = fmt.Errorf("%s, the response is still available with %s", err, mods.styles.inlineCode.Render("mods --last"))
+			}
+			mods.printError()
+			os.Exit(1)
+		}
+	} else if mods.Config.Raw {
+		out := mods.Output
+		if mods.Config.Logprobs {
+			var err error
+			if out, err = logprobsJSON(mods.Logprobs); err != nil {
+				mods.Error = &modsError{reason: "Unable to print the logprobs.", err: err}
+				mods.printError()
+				os.Exit(1)
+			}
+		}
+		printRaw(out, mods.Config)
+	} else if mods.Config.progressive() == progressiveAppend {
+		// The response was printed as it came, but for its last line.
+		fmt.Println(mods.appendedRest() + formatCitations(mods.Citations))
+	} else if mods.Config.progressive() == progressiveRedraw {
+		s := makeStyles(lipgloss.NewRenderer(os.Stdout))
+		printOutput(styleMarkdown(s, mods.FormattedOutput(), mods.Config.CodeStyle), mods.Config)
+	} else if mods.Config.Explain && isatty.IsTerminal(os.Stdout.Fd()) {
+		s := makeStyles(lipgloss.NewRenderer(os.Stdout))
+		printOutput(highlightFlags(s, mods.FormattedOutput()), mods.Config)
+	} else {
+		if mods.Config.TTY && !mods.Config.NoMarkdown && !isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd()) {
+			// The pipe gets the raw response, the terminal a styled copy.
+			fmt.Fprintln(os.Stderr, styleMarkdown(mods.styles, mods.FormattedOutput(), mods.Config.CodeStyle))
+		}
+		printOutput(mods.FormattedOutput(), mods.Config)
+	}
+	render.finish(nil)
+	if mods.finishReason == "length" {
+		fmt.Fprintln(os.Stderr, mods.styles.truncated.Render(maxTokensNotice))
+	}
+	if mods.Config.Verbose && mods.Config.redacting() {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(redactionsNotice(mods.redactions)))
+	}
+	if mods.Config.Stats || mods.Config.Brainstorm > 0 {
+		stats := formatStats(mods.Config.Model, mods.Config.Models[mods.Config.Model], mods.elapsed, mods.usage)
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(stats))
+	}
+	if mods.Config.ShowUsage {
+		fmt.Fprintln(os.Stderr, mods.styles.comment.Render(mods.usageLine()))
+	}
+	if mods.Config.Notify {
+		notify(mods.notificationTitle(), mods.Config.Prefix, mods.responseTokens(mods.usage.completion, mods.Output))
+	}
+	if mods.Config.Speak {
+		if err := speak(mods.Config.SpeakCommand, mods.Output); err != nil {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Unable to read the response out loud: "+err.Error()))
+		}
+	}
+	if mods.Config.Copy {
+		out := mods.Output
+		if mods.Config.As != "" {
+			out = outputAs(mods.Config.As, out)
+		} else if mods.Config.ExtractCode {
+			out = extractCode(out)
+		}
+		if err := clipboard.WriteAll(out); err != nil {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Unable to copy the response to the clipboard: "+err.Error()))
+		}
+	}
+	if out := mods.Config.roleOutput(); out != "stdout" && out != "clipboard" {
+		path, err := appendToRoleOutput(mods.Config, mods.Output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Unable to append the response to the role-outputs file: "+err.Error()))
+		} else if mods.Config.Verbose {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Appended the response to "+path+"."))
+		}
+	}
+	if mods.Config.saving() && len(mods.messages) > 0 {
+		if _, err := mods.saveConversation(true); err != nil {
+			mods.Error = &modsError{reason: "Unable to save the conversation.", err: err}
+			mods.printError()
+			os.Exit(1)
+		}
+		if mods.Config.Verbose && len(mods.evicted) > 0 {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render(evictionNotice(mods.evicted)))
+		}
+		if mods.finishReason == "length" {
+			fmt.Fprintln(os.Stderr, mods.styles.comment.Render("Get the rest with: mods --continue-generation "+mods.chatID))
+		}
+	}
+	mods.exportTrace(nil)
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxMapRequests is the number of parts of the input sent at the same time,
+// to not run into the rate limits of the API with long inputs.
+const maxMapRequests = 4
+
+const defaultMapReducePrompt = "Each of the responses below was given to the instruction for one part of " +
+	"a long input. Combine them into a single response to the instruction, as if it was given the whole input at once."
+
+// mapReduceInput is a tea.Msg that wraps the combined responses to each part
+// of the input, ready to be sent with the combine prompt.
+type mapReduceInput struct{ content string }
+
+// chunkSize returns the number of characters of input that can be sent with
+// the prompt to the model.
+func (m *Mods) chunkSize() int {
+	size := m.Config.MaxInputChars
+	if mod, ok := m.Config.Models[m.Config.Model]; ok && mod.MaxChars > 0 {
+		size = mod.MaxChars
+	}
+	size -= len(m.Config.Prefix) + len(markdownPrefix) + len(m.Config.MapReducePrompt) + 4 //nolint:gomnd
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// splitChunks splits the text in chunks of at most size bytes, breaking at
+// paragraphs or lines when possible, and never in the middle of a character.
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		i := strings.LastIndex(text[:size], "\n\n")
+		if i <= 0 {
+			i = strings.LastIndex(text[:size], "\n")
+		}
+		if i <= 0 {
+			i = size
+			for i > 0 && !utf8.RuneStart(text[i]) {
+				i--
+			}
+		}
+		if i == 0 {
+			// A character longer than the size.
+			_, i = utf8.DecodeRuneInString(text)
+		}
+		chunks = append(chunks, text[:i])
+		text = strings.TrimLeft(text[i:], "\n")
+	}
+	if strings.TrimSpace(text) != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// mapReduceCmd sends the prompt with each chunk of the content, up to
+// maxMapRequests at the same time, then combines the responses. Responses
+// that don't fit in a single request together are combined again in chunks
+// while they get shorter.
+func (m *Mods) mapReduceCmd(content string) tea.Cmd {
+	return func() tea.Msg {
+		size := m.chunkSize()
+		header := ""
+		for {
+			chunks := splitChunks(content, size)
+			results := make([]compareResult, len(chunks))
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, maxMapRequests)
+			for i, chunk := range chunks {
+				wg.Add(1)
+				go func(i int, chunk string) {
+					defer wg.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					mc := *m
+					mc.cancelRequest = nil
+					mc.retries = 0
+					results[i] = mc.completeWith(fmt.Sprint(i+1), strings.TrimSpace(header+chunk))
+				}(i, chunk)
+			}
+			wg.Wait()
+
+			var b strings.Builder
+			for _, r := range results {
+				if r.err != nil {
+					merr := modsError{}
+					if errors.As(r.err, &merr) {
+						return merr
+					}
+					return modsError{r.err, fmt.Sprintf("There was an error with part %s of the input.", r.label)}
+				}
+				fmt.Fprintf(&b, "# Part %s\n\n%s\n\n", r.label, strings.TrimSpace(r.content))
+			}
+			combined := strings.TrimSpace(b.String())
+			// Stop combining if it doesn't make the responses shorter, the
+			// last request truncates them instead.
+			if len(combined) <= size || len(combined) >= len(content) {
+				return mapReduceInput{combined}
+			}
+			content = combined
+			header = m.Config.MapReducePrompt + "\n\n"
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+		want []string
+	}{
+		{"short", "hello", 10, []string{"hello"}},
+		{"paragraphs", "one two\n\nthree\nfour", 12, []string{"one two", "three\nfour"}},
+		{"lines", "one\ntwo\nthree", 9, []string{"one\ntwo", "three"}},
+		{"no breaks", "abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"multibyte", "héllo wörld", 3, []string{"hé", "llo", " w", "ör", "ld"}},
+		{"wider than the size", "世界", 1, []string{"世", "界"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitChunks(tt.text, tt.size)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, c := range got {
+				if !utf8.ValidString(c) {
+					t.Errorf("chunk %q cut in the middle of a character", c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mathBlockRe  = regexp.MustCompile(`(?s)\$\$(.+?)\$\$|\\\[(.+?)\\\]`)
+	mathInlineRe = regexp.MustCompile(`\$([^\s$](?:[^$\n]*[^\s$])?)\$(?:[^0-9]|$)|\\\((.+?)\\\)`)
+	mathCmdRe    = regexp.MustCompile(`\\([a-zA-Z]+)`)
+	mathScriptRe = regexp.MustCompile(`([_^])(?:\{([^{}]*)\}|([a-zA-Z0-9+\-=()]))`)
+	// mathBlockMarkRe finds the rendered blocks, between NUL characters, to
+	// put them on their own lines.
+	mathBlockMarkRe = regexp.MustCompile(`[ \t]*\n?[ \t]*\n*\x00([^\x00]*)\x00[ \t]*\n*`)
+)
+
+// mathSymbols are the unicode forms of the LaTeX commands, by name.
+var mathSymbols = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "iota": "ι",
+	"kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π",
+	"rho": "ρ", "sigma": "σ", "tau": "τ", "upsilon": "υ", "phi": "φ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω", "Gamma": "Γ",
+	"Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"sum": "∑", "prod": "∏", "int": "∫", "oint": "∮", "partial": "∂",
+	"nabla": "∇", "infty": "∞", "sqrt": "√", "pm": "±", "mp": "∓",
+	"times": "×", "div": "÷", "cdot": "·", "ast": "∗", "circ": "∘",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "propto": "∝", "ll": "≪",
+	"gg": "≫", "in": "∈", "notin": "∉", "subset": "⊂", "subseteq": "⊆",
+	"supset": "⊃", "supseteq": "⊇", "cup": "∪", "cap": "∩", "emptyset": "∅",
+	"forall": "∀", "exists": "∃", "neg": "¬", "land": "∧", "lor": "∨",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "Rightarrow": "⇒",
+	"Leftarrow": "⇐", "leftrightarrow": "↔", "Leftrightarrow": "⇔",
+	"implies": "⇒", "iff": "⇔", "mapsto": "↦", "ldots": "…", "cdots": "⋯",
+	"dots": "…", "hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "angle": "∠",
+	"perp": "⊥", "parallel": "∥", "degree": "°", "quad": "  ", "qquad": "    ",
+	"log": "log", "ln": "ln", "exp": "exp", "sin": "sin", "cos": "cos",
+	"tan": "tan", "lim": "lim", "max": "max", "min": "min", "det": "det",
+	"left": "", "right": "", "displaystyle": "",
+}
+
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶',
+	'7': '⁷', '8': '⁸', '9': '⁹', '+': '⁺', '-': '⁻', '=': '⁼', '(': '⁽',
+	')': '⁾', 'n': 'ⁿ', 'i': 'ⁱ', 'x': 'ˣ', 'y': 'ʸ', 'a': 'ᵃ', 'b': 'ᵇ',
+	'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'k': 'ᵏ', 'm': 'ᵐ', 'T': 'ᵀ',
+}
+
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆',
+	'7': '₇', '8': '₈', '9': '₉', '+': '₊', '-': '₋', '=': '₌', '(': '₍',
+	')': '₎', 'a': 'ₐ', 'e': 'ₑ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'n': 'ₙ',
+	'm': 'ₘ', 'o': 'ₒ', 'x': 'ₓ', 't': 'ₜ',
+}
+
+// renderMath replaces the LaTeX math of the response, between $$ or \[ \]
+// for blocks and $ or \( \) inline, with a readable unicode form. What can't
+// be converted is kept without its delimiters. Code blocks and inline code
+// are left alone.
+func renderMath(text string) string {
+	lines := strings.Split(text, "\n")
+	var out, prose []string
+	flush := func() {
+		if len(prose) > 0 {
+			out = append(out, strings.Split(renderMathProse(strings.Join(prose, "\n")), "\n")...)
+			prose = nil
+		}
+	}
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flush()
+			inCode = !inCode
+			out = append(out, line)
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		prose = append(prose, line)
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// renderMathProse renders the math of text without code blocks, skipping the
+// inline code.
+func renderMathProse(text string) string {
+	parts := strings.Split(text, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = mathBlockRe.ReplaceAllStringFunc(parts[i], func(s string) string {
+			m := mathBlockRe.FindStringSubmatch(s)
+			return "\x00" + mathToUnicode(m[1]+m[2]) + "\x00"
+		})
+		parts[i] = mathInlineRe.ReplaceAllStringFunc(parts[i], func(s string) string {
+			m := mathInlineRe.FindStringSubmatch(s)
+			if m[2] != "" {
+				return mathToUnicode(m[2])
+			}
+			// The character after the closing $ was matched too.
+			return mathToUnicode(m[1]) + strings.TrimPrefix(s, "$"+m[1]+"$")
+		})
+	}
+	text = strings.Join(parts, "`")
+	// Blocks go on their own lines, indented, between blank lines, keeping
+	// the newlines the text started and ended with.
+	lead := text[:len(text)-len(strings.TrimLeft(text, "\n"))]
+	trail := text[len(strings.TrimRight(text, "\n")):]
+	text = mathBlockMarkRe.ReplaceAllString(text, "\n\n    $1\n\n")
+	return lead + strings.Trim(text, "\n") + trail
+}
+
+// mathToUnicode converts a LaTeX expression, or returns it as is if it uses
+// commands it doesn't know.
+func mathToUnicode(expr string) string {
+	s := strings.TrimSpace(expr)
+	s = replaceMathArgs(s, "frac", 2, func(args []string) string {
+		return mathGroup(args[0]) + "/" + mathGroup(args[1])
+	})
+	s = replaceMathArgs(s, "sqrt", 1, func(args []string) string {
+		return "√" + mathGroup(args[0])
+	})
+	for _, cmd := range []string{"text", "mathrm", "mathbf", "mathit", "mathbb", "mathcal", "operatorname", "boldsymbol"} {
+		s = replaceMathArgs(s, cmd, 1, func(args []string) string { return args[0] })
+	}
+	s = mathCmdRe.ReplaceAllStringFunc(s, func(c string) string {
+		if sym, ok := mathSymbols[c[1:]]; ok {
+			return sym
+		}
+		return c
+	})
+	s = strings.ReplaceAll(s, `\,`, " ")
+	s = strings.ReplaceAll(s, `\\`, "; ")
+	if mathCmdRe.MatchString(s) {
+		return strings.TrimSpace(expr)
+	}
+	s = mathScriptRe.ReplaceAllStringFunc(s, func(c string) string {
+		m := mathScriptRe.FindStringSubmatch(c)
+		table := superscripts
+		if m[1] == "_" {
+			table = subscripts
+		}
+		arg := m[2] + m[3]
+		var b strings.Builder
+		for _, r := range arg {
+			sr, ok := table[r]
+			if !ok {
+				// Not every character has a unicode form.
+				return m[1] + mathGroup(arg)
+			}
+			b.WriteRune(sr)
+		}
+		return b.String()
+	})
+	s = strings.NewReplacer("{", "", "}", "").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// replaceMathArgs replaces the uses of the command with n arguments in braces
+// by what f returns for them, innermost first.
+func replaceMathArgs(s, cmd string, n int, f func([]string) string) string {
+	for {
+		i := lastMathCmd(s, cmd)
+		if i < 0 {
+			return s
+		}
+		j := i + len(cmd) + 1
+		args := make([]string, 0, n)
+		for k := 0; k < n; k++ {
+			arg, end, ok := mathBraced(s, j)
+			if !ok {
+				// Malformed, leave the rest as is.
+				return s
+			}
+			args = append(args, arg)
+			j = end
+		}
+		s = s[:i] + f(args) + s[j:]
+	}
+}
+
+// lastMathCmd returns the index of the last use of the command, not followed
+// by another letter, or -1.
+func lastMathCmd(s, cmd string) int {
+	for end := len(s); end > 0; {
+		i := strings.LastIndex(s[:end], `\`+cmd)
+		if i < 0 {
+			return -1
+		}
+		next := i + len(cmd) + 1
+		if next >= len(s) || !isASCIILetter(s[next]) {
+			return i
+		}
+		end = i
+	}
+	return -1
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// mathBraced returns the content of the braces starting at i, after spaces,
+// and the index after them.
+func mathBraced(s string, i int) (string, int, bool) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i >= len(s) {
+		return "", i, false
+	}
+	if s[i] != '{' {
+		// A single character argument, like \frac12.
+		return s[i : i+1], i + 1, true
+	}
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[i+1 : j], j + 1, true
+			}
+		}
+	}
+	return "", i, false
+}
+
+// mathGroup wraps the expression in parentheses unless it's a single term.
+func mathGroup(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, " +-*/=") {
+		return "(" + s + ")"
+	}
+	return s
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// promptMiddleware transforms the messages before they're sent to the model.
+// Errors meant for the user are returned as a modsError.
+type promptMiddleware func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error)
+
+// promptMiddlewares returns the transformations applied to the messages of
+// each request, in order. Features changing the prompt register here.
+func (m *Mods) promptMiddlewares(cfg config, mod Model) []promptMiddleware {
+	return []promptMiddleware{
+		compactHistoryMiddleware(cfg),
+		m.diagnoseMiddleware(cfg),
+		m.prefixMiddleware(cfg),
+		m.gitContextMiddleware(cfg),
+		m.systemMiddleware(cfg),
+		contextFileMiddleware(cfg),
+		m.redactMiddleware(cfg),
+		limitMiddleware(cfg, mod),
+	}
+}
+
+// applyMiddlewares runs the messages through the middlewares, in order.
+func applyMiddlewares(messages []openai.ChatCompletionMessage, mws []promptMiddleware) ([]openai.ChatCompletionMessage, error) {
+	for _, mw := range mws {
+		var err error
+		if messages, err = mw(messages); err != nil {
+			var me modsError
+			if errors.As(err, &me) {
+				return nil, me
+			}
+			return nil, modsError{err, "There was an error while preparing the prompt."}
+		}
+	}
+	return messages, nil
+}
+
+// lastUserMessage returns the index of the message being sent, or -1.
+func lastUserMessage(messages []openai.ChatCompletionMessage) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			return i
+		}
+	}
+	return -1
+}
+
+// prefixMiddleware adds the prompt given as arguments, and the Markdown
+// instruction of --format and the one of --steps, before the message being
+// sent, separated from it by --prompt-separator.
+func (m *Mods) prefixMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		// The refinements go on with the conversation, the prompt was
+		// already sent.
+		i := lastUserMessage(messages)
+		if len(m.steps) > 0 || i < 0 {
+			return messages, nil
+		}
+		prefix := cfg.Prefix
+		if r, ok := cfg.customRole(); ok && r.Prompt != "" {
+			// The template places the prompt given as arguments itself.
+			content, err := cfg.rolePrompt(r.Prompt, cfg.Prefix, messages[i].Content)
+			if err != nil {
+				return nil, modsError{withExitCode(err, exitConfig), "There was an error in the prompt of your role."}
+			}
+			messages[i].Content = content
+			prefix = ""
+		}
+		if cfg.Markdown {
+			prefix = fmt.Sprintf("%s %s", prefix, markdownPrefix)
+		}
+		if cfg.Steps {
+			prefix = fmt.Sprintf("%s %s", prefix, stepsPrefix)
+		}
+		if prefix == "" {
+			return messages, nil
+		}
+		if strings.TrimSpace(messages[i].Content) == "" {
+			messages[i].Content = strings.TrimSpace(prefix)
+		} else {
+			messages[i].Content = strings.TrimSpace(prefix + cfg.PromptSeparator + messages[i].Content)
+		}
+		return messages, nil
+	}
+}
+
+// systemMiddleware sends the system prompt first.
+func (m *Mods) systemMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		system, err := cfg.systemPrompt()
+		if err != nil {
+			return nil, modsError{
+				reason: "There was an error in your system prompt settings.",
+				err:    withExitCode(fmt.Errorf("%s, variables can be set with %s", err, m.styles.inlineCode.Render("--var name=value")), exitConfig),
+			}
+		}
+		return withSystem(messages, system), nil
+	}
+}
+
+// contextFileMiddleware adds the content of the context file at the end of
+// the system prompt.
+func contextFileMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		pinned, err := cfg.pinnedContext()
+		if err != nil {
+			return nil, modsError{withExitCode(err, exitConfig), "Unable to read your context file."}
+		}
+		return withSystem(messages, pinned), nil
+	}
+}
+
+// withSystem adds the text to the system message, which is created first if
+// there's none yet.
+func withSystem(messages []openai.ChatCompletionMessage, text string) []openai.ChatCompletionMessage {
+	if text == "" {
+		return messages
+	}
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+		messages[0].Content = strings.TrimSpace(messages[0].Content + "\n\n" + text)
+		return messages
+	}
+	system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: text}
+	return append([]openai.ChatCompletionMessage{system}, messages...)
+}
+
+// systemMessage returns the system message sent with the requests, as shown
+// by --show-system.
+func (m *Mods) systemMessage(cfg config) (string, error) {
+	messages, err := applyMiddlewares(nil, []promptMiddleware{
+		m.systemMiddleware(cfg),
+		contextFileMiddleware(cfg),
+		m.redactMiddleware(cfg),
+	})
+	if err != nil || len(messages) == 0 {
+		return "", err
+	}
+	return messages[0].Content, nil
+}
+
+// redactMiddleware replaces the secrets of the system prompt and of the
+// message being sent, counting the redactions for --verbose.
+func (m *Mods) redactMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		if !cfg.redacting() {
+			return messages, nil
+		}
+		r, err := newRedactor(cfg.Redact, cfg.RedactSecrets)
+		if err != nil {
+			return nil, modsError{withExitCode(err, exitConfig), "There was an error in your redact settings."}
+		}
+		m.redactions = 0
+		last := lastUserMessage(messages)
+		for i := range messages {
+			if i == last || messages[i].Role == openai.ChatMessageRoleSystem {
+				var n int
+				messages[i].Content, n = r.redact(messages[i].Content)
+				m.redactions += n
+			}
+		}
+		return messages, nil
+	}
+}
+
+// limitMiddleware cuts the message being sent to the maximum input of the
+// model, then to the tokens of --max-input-tokens, unless --no-limit is set,
+// keeping the part chosen with --truncate.
+func limitMiddleware(cfg config, mod Model) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		i := lastUserMessage(messages)
+		if cfg.NoLimit || i < 0 {
+			return messages, nil
+		}
+		if mod.MaxChars > 0 && len(messages[i].Content) > mod.MaxChars {
+			messages[i].Content = truncateInput(messages[i].Content, mod.MaxChars, cfg.Truncate)
+		}
+		if cfg.MaxInputTokens > 0 {
+			messages[i].Content = truncateTokens(mod.Name, messages[i].Content, cfg.MaxInputTokens, cfg.Truncate)
+		}
+		return messages, nil
+	}
+}
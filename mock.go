@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mockAPI is the name of the built-in API answering without the network, for
+// demos and tests.
+const mockAPI = "mock"
+
+// mockDelay is the default pause between the words of a mock response.
+const mockDelay = 30 * time.Millisecond
+
+// mockCompletion streams back the mock-response of the mock API, or else the
+// prompt, a word at a time. The API doesn't have to be in the settings.
+func mockCompletion(ctx context.Context, api API, content string) tea.Msg {
+	response := api.MockResponse
+	if response == "" {
+		response = "You said: " + content
+	}
+	delay := mockDelay
+	if api.MockDelay != nil {
+		delay = *api.MockDelay
+	}
+	return completionStreamStart{
+		stream: &mockStream{ctx: ctx, rest: response, delay: delay},
+		prompt: content,
+	}
+}
+
+// mockStream sends a response a word at a time, with the spaces after it.
+type mockStream struct {
+	ctx   context.Context
+	rest  string
+	delay time.Duration
+}
+
+func (s *mockStream) Recv() (string, error) {
+	if s.rest == "" {
+		return "", io.EOF
+	}
+	select {
+	case <-s.ctx.Done():
+		return "", s.ctx.Err()
+	case <-time.After(s.delay):
+	}
+	i := strings.IndexAny(s.rest, " \t\n")
+	if i < 0 {
+		i = len(s.rest)
+	}
+	for i < len(s.rest) && strings.ContainsRune(" \t\n", rune(s.rest[i])) {
+		i++
+	}
+	chunk := s.rest[:i]
+	s.rest = s.rest[i:]
+	return chunk, nil
+}
+
+func (s *mockStream) Close() {}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Model represents the LLM model used in the API call.
 type Model struct {
 	Name     string
@@ -7,10 +9,80 @@ type Model struct {
 	MaxChars int      `yaml:"max-input-chars"`
 	Aliases  []string `yaml:"aliases"`
 	Fallback string   `yaml:"fallback"`
+
+	// ContextWindow is the number of tokens the model takes, shown by
+	// --show-budget. Without it, it's estimated from MaxChars.
+	ContextWindow int `yaml:"context-window"`
+
+	// InputPrice and OutputPrice are the prices of a million prompt and
+	// completion tokens, to show the cost of the responses with --stats.
+	InputPrice  float64 `yaml:"input-price"`
+	OutputPrice float64 `yaml:"output-price"`
+
+	// Capabilities lists what the model supports (logprobs, tools, vision,
+	// json), when the API doesn't tell.
+	Capabilities []string `yaml:"capabilities"`
 }
 
 // API represents an API endpoint and its models.
 type API struct {
 	BaseURL string           `yaml:"base-url"`
 	Models  map[string]Model `yaml:"models"`
+
+	// Stream can be set to false for servers that don't support streaming
+	// the responses.
+	Stream *bool `yaml:"stream"`
+
+	// RequestsPerMinute paces the requests made to the API, 0 for no limit.
+	RequestsPerMinute int `yaml:"requests-per-minute"`
+
+	// APIKey is the key sent to the API. If not set, it's read from the
+	// environment variable named by APIKeyEnv, or else from the conventional
+	// variable of the provider.
+	APIKey    string `yaml:"api-key"`
+	APIKeyEnv string `yaml:"api-key-env"`
+
+	// WebSearch are the request parameters enabling the web search of the
+	// provider with --web, OpenAI's web_search_options if not set.
+	WebSearch map[string]any `yaml:"web-search"`
+
+	// Mistral specific request parameters.
+	SafePrompt bool `yaml:"safe-prompt"`
+	RandomSeed *int `yaml:"random-seed"`
+
+	// Settings of the built-in mock API: the response it sends, the prompt
+	// by default, and the pause between its words.
+	MockResponse string         `yaml:"mock-response"`
+	MockDelay    *time.Duration `yaml:"mock-delay"`
+
+	// AWS Bedrock specific settings.
+	Region  string `yaml:"region"`
+	Profile string `yaml:"profile"`
+}
+
+// streams returns whether the responses of the API should be streamed.
+func (a API) streams() bool {
+	return a.Stream == nil || *a.Stream
+}
+
+// extraParams returns the provider specific parameters that should be added
+// to the requests made to this API.
+func (a API) extraParams() map[string]any {
+	params := map[string]any{}
+	if a.SafePrompt {
+		params["safe_prompt"] = true
+	}
+	if a.RandomSeed != nil {
+		params["random_seed"] = *a.RandomSeed
+	}
+	return params
+}
+
+// webSearchParams returns the request parameters that enable the web search
+// tool of the provider.
+func (a API) webSearchParams() map[string]any {
+	if len(a.WebSearch) > 0 {
+		return a.WebSearch
+	}
+	return map[string]any{"web_search_options": map[string]any{}}
 }
@@ -11,15 +11,30 @@ import (
 	"os"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/mods/anim"
 	"github.com/mattn/go-isatty"
 	openai "github.com/sashabaranov/go-openai"
 )
 
 const markdownPrefix = "Format the response as Markdown."
 
+// apiKeys maps the APIs that require a key to the environment variable
+// holding it and where to get one.
+var apiKeys = map[string]struct{ env, url string }{
+	"openai":     {"OPENAI_API_KEY", "https://platform.openai.com/account/api-keys."},
+	"mistral":    {"MISTRAL_API_KEY", "https://console.mistral.ai/api-keys."},
+	"groq":       {"GROQ_API_KEY", "https://console.groq.com/keys."},
+	"perplexity": {"PERPLEXITY_API_KEY", "https://www.perplexity.ai/settings/api."},
+	"anthropic":  {"ANTHROPIC_API_KEY", "https://console.anthropic.com/settings/keys."},
+	"deepseek":   {"DEEPSEEK_API_KEY", "https://platform.deepseek.com/api_keys."},
+	"openrouter": {"OPENROUTER_API_KEY", "https://openrouter.ai/settings/keys."},
+}
+
 type state int
 
 const (
@@ -27,22 +42,76 @@ const (
 	configLoadedState
 	completionState
 	errorState
+	chatInputState
+	setupState
+	choosingState
+	toolConfirmState
+	doneState
 )
 
 // Mods is the Bubble Tea model that manages reading stdin and querying the
 // OpenAI API.
 type Mods struct {
-	Config   config
-	Output   string
-	Input    string
-	Error    *modsError
-	state    state
-	retries  int
-	styles   styles
-	renderer *lipgloss.Renderer
-	anim     tea.Model
-	width    int
-	height   int
+	Config    config
+	Output    string
+	Citations []string
+	Logprobs  []tokenLogprob
+	Reasoning string
+	Input     string
+	Error     *modsError
+	state     state
+	retries   int
+	styles    styles
+	renderer  *lipgloss.Renderer
+	anim      tea.Model
+	width     int
+	height    int
+	messages  []openai.ChatCompletionMessage
+	chatInput textinput.Model
+	chatID    string
+	continued *conversation
+	echoed    bool
+	reasoning map[int]string
+	history   chatHistory
+	setup     *setup
+	choices   []string
+	budget    string
+	choosing  *choosing
+	terminal  bool
+	fifo      *fifoWriter
+	trace     *tracer
+	request   *span
+	tools     *toolRun
+	toolTurns []map[string]any
+
+	stream        completionStream
+	prompt        string
+	extras        *responseExtras
+	cancelRequest context.CancelFunc
+	stopped       bool
+	aborted       bool
+	redactions    int
+	evicted       []conversation
+	warning       string
+	steps         []string
+	animFailed    bool
+	lastInput     string
+	started       time.Time
+	elapsed       time.Duration
+	usage         tokenUsage
+	finishReason  string
+	dropped       string
+	toolRounds    int
+	toolsAllowed  bool
+	promptTokens  int
+	promptExact   bool
+	ansiHeld      string
+
+	appended      int
+	chunks        int
+	revealing     bool
+	revealed      int
+	pendingOutput *completionOutput
 }
 
 func newMods(r *lipgloss.Renderer) *Mods {
@@ -51,14 +120,43 @@ func newMods(r *lipgloss.Renderer) *Mods {
 		state:    startState,
 		renderer: r,
 		styles:   s,
+		trace:    newTracer(),
 	}
 }
 
 // completionInput is a tea.Msg that wraps the content read from stdin.
 type completionInput struct{ content string }
 
+// completionRetry is a tea.Msg that sends the request again, with the input
+// as it was before the middlewares, which run again.
+type completionRetry struct{ content string }
+
 // completionOutput a tea.Msg that wraps the content returned from openai.
-type completionOutput struct{ content string }
+type completionOutput struct {
+	prompt    string
+	content   string
+	citations []string
+	logprobs  []tokenLogprob
+	reasoning string
+	usage     tokenUsage
+	truncated bool
+	empty     bool
+	refusal   string
+	// finishReason is why the model stopped, as reported by the API.
+	finishReason string
+}
+
+// emptyResponseNotice is shown when the model sent nothing, often because of
+// a content filter or a hiccup of the provider.
+const emptyResponseNotice = "The model sent an empty response, try again or use --retry-on-empty."
+
+// streamCutNotice is shown when the response stream ended before the model
+// said it was done.
+const streamCutNotice = "The response ended abruptly, it may be incomplete."
+
+// maxTokensNotice follows a response the model stopped because it reached
+// --max-tokens.
+const maxTokensNotice = "… [response truncated: hit max tokens]"
 
 // modsError is a wrapper around an error that adds additional context.
 type modsError struct {
@@ -70,6 +168,10 @@ func (m modsError) Error() string {
 	return m.err.Error()
 }
 
+func (m modsError) Unwrap() error {
+	return m.err
+}
+
 // Init implements tea.Model.
 func (m *Mods) Init() tea.Cmd {
 	return m.loadConfigCmd
@@ -81,32 +183,272 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case config:
 		m.Config = msg
 		m.state = configLoadedState
-		if m.Config.ShowHelp || m.Config.Version || m.Config.Settings {
+		if m.Config.ShowHelp || m.Config.Version || m.Config.Settings || m.Config.EditConfig || m.Config.ListAPIs || m.Config.ListRoles || m.Config.SetDefaultAPI != "" || m.Config.Last > 0 || m.Config.Import != "" || m.Config.ExportAll != "" || m.Config.Pin != "" || m.Config.Unpin != "" || m.Config.Delete != "" || m.Config.Replay != "" || m.Config.ReplayLast || m.Config.ShowSystem || m.Config.List || m.Config.Rename != "" || m.Config.ScratchReset || m.Config.PrintConfig || m.Config.Ping {
 			return m, tea.Quit
 		}
-		m.anim = newCyclingChars(m.Config.Fanciness, m.Config.StatusText, m.renderer, m.styles)
-		return m, tea.Batch(readStdinCmd, m.anim.Init())
+		if m.Config.Scratch {
+			c, ok, err := scratchConversation()
+			if err != nil {
+				m.Error = &modsError{err, "Unable to continue the scratch conversation."}
+				m.state = errorState
+				return m, tea.Quit
+			}
+			if ok {
+				m.Config.Continue = c.ID
+			}
+		}
+		if m.Config.Continue != "" {
+			if err := m.continueConversation(); err != nil {
+				m.Error = &modsError{err, "Unable to continue the conversation."}
+				m.state = errorState
+				return m, tea.Quit
+			}
+		}
+		if m.Config.ContinueGeneration != "" {
+			if err := m.checkContinuation(); err != nil {
+				m.Error = &modsError{err, "Unable to continue the response."}
+				m.state = errorState
+				return m, tea.Quit
+			}
+		}
+		if m.Config.FIFO != "" {
+			fifo, err := openFIFO(m.Config.FIFO)
+			if err != nil {
+				m.Error = &modsError{withExitCode(err, exitConfig), "Unable to write to the named pipe."}
+				m.state = errorState
+				return m, tea.Quit
+			}
+			m.fifo = fifo
+		}
+		if m.Config.Examples != "" {
+			examples, err := loadExamples(m.Config.Examples)
+			if err != nil {
+				m.Error = &modsError{withExitCode(err, exitConfig), "Unable to load the examples."}
+				m.state = errorState
+				return m, tea.Quit
+			}
+			m.messages = append(m.messages, examples...)
+		}
+		if m.Config.Examples != "" || len(m.Config.Messages) > 0 {
+			m.messages = append(m.messages, m.Config.Messages...)
+			m.warning = seedWarning(m.messages)
+		}
+		m.styles.cyclingChars = m.renderer.NewStyle().Foreground(lipgloss.Color(m.Config.theme.CyclingChars))
+		var yolo tea.Cmd
+		if m.Config.Yolo {
+			m.toolsAllowed = true
+			yolo = tea.Println(m.yoloWarning())
+		}
+		if m.Config.Chat {
+			return m, tea.Batch(yolo, m.startChat(), m.keepaliveCmd())
+		}
+		m.anim = m.newAnimation()
+		if m.Config.RawRequest != "" {
+			m.state = completionState
+			return m, tea.Batch(m.rawRequestCmd(), m.anim.Init(), m.keepaliveCmd())
+		}
+		return m, tea.Batch(yolo, readStdinCmd, m.anim.Init(), m.keepaliveCmd())
+	case chatPipedInput:
+		return m, m.startPipedChat(msg.content)
+	case completionRetry:
+		return m, m.startCompletionCmd(msg.content)
 	case completionInput:
-		if msg.content == "" && m.Config.Prefix == "" {
+		if strings.TrimSpace(msg.content) == "" {
+			// Don't send whitespace only input along with the prompt.
+			msg.content = ""
+		}
+		if msg.content == "" && m.Config.Prefix == "" && !m.Config.GitContext {
 			return m, tea.Quit
 		}
 		if msg.content != "" {
 			m.Input = msg.content
 		}
 		m.state = completionState
+		if m.started.IsZero() {
+			m.started = time.Now()
+		}
+		if m.Config.Bench {
+			return m, m.benchCmd(msg.content)
+		}
+		if len(m.Config.Compare) > 0 {
+			return m, m.compareCmd(msg.content, m.Config.compareVariants(), true)
+		}
+		if len(m.Config.TempSweep) > 0 {
+			return m, m.compareCmd(msg.content, m.Config.tempSweepVariants(), false)
+		}
+		if m.Config.Brainstorm > 0 {
+			return m, m.compareCmd(msg.content, m.Config.brainstormVariants(), false)
+		}
+		if m.Config.MapReduce && len(msg.content) > m.chunkSize() {
+			return m, m.mapReduceCmd(msg.content)
+		}
 		return m, m.startCompletionCmd(msg.content)
-	case completionOutput:
-		m.Output = msg.content
+	case configError:
+		m.Config.ErrorFormat = msg.errorFormat
+		return m.Update(msg.err)
+	case mapReduceInput:
+		return m, m.startCompletionCmd(m.Config.MapReducePrompt + "\n\n" + msg.content)
+	case benchOutput:
+		m.Output = formatBench(msg)
+		return m, tea.Quit
+	case assembledPrompt:
+		m.Output = msg.text
+		return m, tea.Quit
+	case compareOutput:
+		m.Output = formatComparison(msg.results, msg.diff)
+		m.elapsed = time.Since(m.started)
+		if !msg.diff {
+			// The variants of --compare use different models, their usage
+			// can't be priced together.
+			for _, r := range msg.results {
+				m.usage = m.usage.add(r.usage)
+			}
+		}
 		return m, tea.Quit
+	case completionStreamStart:
+		if m.budget != "" {
+			budget := m.budget
+			m.budget = ""
+			return m, tea.Sequence(tea.Println(budget), m.startStream(msg))
+		}
+		return m, m.startStream(msg)
+	case completionStreamChunk:
+		if m.stopped && m.Config.StopAfterCode {
+			// What was sent before the request was canceled.
+			return m, m.receiveCompletionStreamCmd
+		}
+		if !m.Config.AllowANSI {
+			msg.content, m.ansiHeld = escapeANSIChunk(msg.content, m.ansiHeld)
+		}
+		m.Output += msg.content
+		if m.Config.StopAfterCode {
+			if end := firstCodeBlockEnd(m.Output); end >= 0 {
+				// The \r of the closing fence can be in the chunk before.
+				cut := len(m.Output) - end
+				if cut > len(msg.content) {
+					cut = len(msg.content)
+				}
+				msg.content = msg.content[:len(msg.content)-cut]
+				m.Output = m.Output[:end]
+				m.stopStream()
+			}
+		}
+		if m.fifo != nil {
+			m.fifo.write(msg.content)
+		}
+		if m.chunks == 0 {
+			m.request.event("first_token")
+		}
+		m.chunks++
+		m.updateProgress()
+		if m.Config.MaxBufferBytes > 0 && m.aheadBytes() > m.Config.MaxBufferBytes {
+			return m.Update(m.bufferError())
+		}
+		return m, tea.Batch(m.receiveCompletionStreamCmd, m.appendLines())
+	case completionStreamDrop:
+		return m.dropStream(msg)
+	case completionStreamEnd:
+		out := m.endStream()
+		if err := refusalError(out); err != nil {
+			return m.Update(*err)
+		}
+		if out.truncated {
+			if m.Config.RetryOnTruncation && m.canRetry() {
+				m.retries++
+				return m, m.startCompletionCmd(m.lastInput)
+			}
+			m.warning = streamCutNotice
+		}
+		// The arguments of the calls of a response that was cut can be
+		// incomplete, they're only run once the model is done with them.
+		if m.extras != nil && len(m.extras.toolCalls) > 0 && m.Config.UseTools && !out.truncated && out.finishReason == "tool_calls" {
+			return m, m.startToolCalls(out, m.extras.toolCalls)
+		}
+		if out.empty {
+			if m.Config.RetryOnEmpty && m.canRetry() {
+				m.retries++
+				return m, m.startCompletionCmd(m.lastInput)
+			}
+			m.warning = emptyResponseNotice
+		}
+		if len(m.choices) > 1 {
+			return m, m.startChoosing(out)
+		}
+		if m.revealing {
+			// Finish once the rest of the response is revealed.
+			m.pendingOutput = &out
+			return m, nil
+		}
+		return m, m.finishCompletion(out)
+	case toolOutput:
+		m.tools.results = append(m.tools.results, msg.output)
+		return m, m.nextToolCall()
+	case revealTick:
+		return m, m.updateReveal()
+	case setupStart:
+		return m, m.startSetup(msg.cause)
+	case setupSaved:
+		return m, m.finishSetup(msg)
+	case keepaliveTick:
+		return m, m.keepalive()
 	case modsError:
+		if m.dropped != "" && m.state == completionState {
+			// The request sent again after a drop failed, the part of the
+			// response received before is kept.
+			return m.dropStream(completionStreamDrop{msg.err})
+		}
+		m.closeStream()
+		m.request.finish(msg)
+		if m.Config.Chat && m.state == completionState {
+			return m, m.chatError(msg)
+		}
+		if a, ok := m.anim.(anim.Model); ok && !m.Config.Quiet && m.state == completionState {
+			// Leave the animation on screen, showing that it failed.
+			m.anim = a.Fail()
+			m.animFailed = true
+		}
 		m.Error = &msg
 		m.state = errorState
 		return m, tea.Quit
 	case tea.WindowSizeMsg:
+		shrunk := msg.Width < m.width
 		m.width, m.height = msg.Width, msg.Height
+		if shrunk && m.Config.RedrawOnResize && m.wrapsResponse() {
+			// The terminal reflowed the lines drawn at the old width, they
+			// can't be erased one by one anymore.
+			return m, tea.ClearScreen
+		}
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c":
+		if m.state == chatInputState {
+			return m, m.updateChatInput(msg)
+		}
+		if m.state == setupState {
+			return m, m.updateSetup(msg)
+		}
+		if m.state == choosingState {
+			return m, m.updateChoosing(msg)
+		}
+		if m.state == toolConfirmState {
+			return m, m.updateToolConfirm(msg)
+		}
+		if msg.String() == "ctrl+c" && m.revealing {
+			// Show the rest of the response right away.
+			return m, m.flushReveal()
+		}
+		if msg.String() == "ctrl+c" {
+			m.aborted = true
+			m.closeStream()
+			return m, tea.Quit
+		}
+		if isStopKey(msg) {
+			if m.stream == nil && m.revealing {
+				return m, m.flushReveal()
+			}
+			if m.stream != nil {
+				// Stop generating but keep what we got so far.
+				m.stopStream()
+				return m, nil
+			}
 			return m, tea.Quit
 		}
 	}
@@ -115,19 +457,81 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.anim, cmd = m.anim.Update(msg)
 		return m, cmd
 	}
+	if m.state == chatInputState {
+		var cmd tea.Cmd
+		m.chatInput, cmd = m.chatInput.Update(msg)
+		return m, cmd
+	}
+	if m.state == setupState && m.setup.step == setupKey {
+		var cmd tea.Cmd
+		m.setup.key, cmd = m.setup.key.Update(msg)
+		return m, cmd
+	}
 	return m, nil
 }
 
+// finishCompletion hands the completed response to the chat, or quits to
+// print it.
+func (m *Mods) finishCompletion(out completionOutput) tea.Cmd {
+	// The tool calls only matter until the answer.
+	m.toolTurns, m.toolRounds = nil, 0
+	m.usage = m.usage.add(out.usage)
+	m.elapsed = time.Since(m.started)
+	if cmd := m.refineCmd(out); cmd != nil {
+		return cmd
+	}
+	if m.Config.Chat {
+		return m.chatOutput(out)
+	}
+	m.Citations = out.citations
+	m.Logprobs = out.logprobs
+	m.Reasoning = out.reasoning
+	m.finishReason = out.finishReason
+	if m.Config.ContinueGeneration != "" {
+		m.continueResponse(out.content)
+		m.state = doneState
+		return tea.Quit
+	}
+	m.messages = append(m.messages, userMessage(out.prompt), assistantMessage(out.content))
+	m.keepReasoning(out.reasoning)
+	m.state = doneState
+	return tea.Quit
+}
+
 // View implements tea.Model.
 func (m *Mods) View() string {
 	//nolint:exhaustive
 	switch m.state {
 	case errorState:
+		if m.Config.ErrorFormat == "json" {
+			// Printed once the program exits.
+			return ""
+		}
+		if m.animFailed {
+			return m.anim.View() + "\n" + m.ErrorView()
+		}
 		return m.ErrorView()
 	case completionState:
+		if m.revealing && m.revealed > 0 {
+			return m.revealView()
+		}
+		if m.Output != "" && m.Config.progressive() != progressiveOff {
+			return m.progressiveView()
+		}
 		if !m.Config.Quiet {
 			return m.anim.View()
 		}
+	case setupState:
+		return m.setupView()
+	case choosingState:
+		return m.choosingView()
+	case toolConfirmState:
+		return m.toolConfirmView()
+	case chatInputState:
+		if m.history.searching {
+			return m.historySearchView()
+		}
+		return m.chatInput.View()
 	}
 	return ""
 }
@@ -155,6 +559,9 @@ func (m *Mods) FormattedOutput() string {
 	stdinFormat := "```\n%s```\n\n---\n\n%s"
 	out := m.Output
 
+	out += formatCitations(m.Citations)
+	out += formatLogprobs(m.Logprobs)
+
 	if m.Config.IncludePrompt != 0 {
 		if m.Config.IncludePrompt < 0 {
 			out = fmt.Sprintf(stdinFormat, m.Input, out)
@@ -179,104 +586,267 @@ func (m *Mods) FormattedOutput() string {
 	return out
 }
 
+// formatCitations returns the list of sources to add after a response.
+func formatCitations(citations []string) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	out := "\n\nSources:"
+	for i, c := range citations {
+		out += fmt.Sprintf("\n%d. %s", i+1, c)
+	}
+	return out
+}
+
+// canRetry reports whether the request can be sent again automatically: it's
+// not past --max-retries, and no tool was called for the answer yet, as the
+// model asked again could run the same commands again.
+func (m *Mods) canRetry() bool {
+	return m.retries < m.Config.MaxRetries && len(m.toolTurns) == 0
+}
+
 func (m *Mods) retry(content string, err modsError) tea.Msg {
+	if len(m.toolTurns) > 0 {
+		err.err = fmt.Errorf("%w, it isn't sent again after the tool calls", err.err)
+		return err
+	}
 	m.retries++
 	if m.retries >= m.Config.MaxRetries {
 		return err
 	}
 	wait := time.Millisecond * 100 * time.Duration(math.Pow(2, float64(m.retries))) //nolint:gomnd
 	time.Sleep(wait)
-	return completionInput{content}
+	return completionRetry{content}
+}
+
+// shrinkInput cuts the end of the input to send it again after the prompt
+// was too long for the model, on a character boundary. It returns false when
+// there's nothing left to cut.
+func shrinkInput(s string) (string, bool) {
+	const cut = 10
+	if len(s) <= cut {
+		return s, false
+	}
+	i := len(s) - cut
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i], true
 }
 
 func (m *Mods) loadConfigCmd() tea.Msg {
+	span := m.trace.startSpan("config.load", nil)
 	cfg, err := newConfig()
+	span.finish(err)
 	if err != nil {
-		return modsError{err, "There was an error in your config file."}
+		return configError{
+			errorFormat: cfg.ErrorFormat,
+			err:         modsError{withExitCode(err, exitConfig), "There was an error in your config file."},
+		}
 	}
 	return cfg
 }
 
+// configError is a tea.Msg sent when the settings couldn't be loaded. It
+// keeps the error format, as the rest of the settings can't be used.
+type configError struct {
+	errorFormat string
+	err         modsError
+}
+
 func (m *Mods) startCompletionCmd(content string) tea.Cmd {
+	if m.cancelRequest != nil {
+		m.cancelRequest()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelRequest = cancel
+	m.lastInput = content
 	return func() tea.Msg {
 		var ok bool
 		var mod Model
-		var key string
 		cfg := m.Config
 		mod, ok = cfg.Models[cfg.Model]
 		if !ok {
 			if cfg.API == "" {
+				err := fmt.Errorf("Please specify an API endpoint with %s or configure the model in the settings: %s", m.styles.inlineCode.Render("--api"), m.styles.inlineCode.Render("mods -s"))
+				if names := cfg.modelSuggestions(cfg.Model); len(names) > 0 {
+					for i, n := range names {
+						names[i] = m.styles.inlineCode.Render(n)
+					}
+					err = fmt.Errorf("Did you mean %s? %w", strings.Join(names, ", "), err)
+				}
 				return modsError{
 					reason: "Model " + m.styles.inlineCode.Render(cfg.Model) + " is not in the settings file.",
-					err:    fmt.Errorf("Please specify an API endpoint with %s or configure the model in the settings: %s", m.styles.inlineCode.Render("--api"), m.styles.inlineCode.Render("mods -s")),
+					err:    withExitCode(err, exitConfig),
 				}
 			}
 			mod.Name = cfg.Model
-			mod.API = cfg.API
 			mod.MaxChars = cfg.MaxInputChars
 		}
+		if cfg.API != "" {
+			mod.API = cfg.API
+		}
 
-		if mod.API == "openai" {
-			key = os.Getenv("OPENAI_API_KEY")
-			if key == "" {
-				return modsError{
-					reason: m.styles.inlineCode.Render("OPENAI_API_KEY") + " environment variabled is required.",
-					err:    fmt.Errorf("You can grab one at %s", m.styles.link.Render("https://platform.openai.com/account/api-keys.")),
-				}
-			}
+		messages := make([]openai.ChatCompletionMessage, 0, len(m.messages)+2) //nolint:gomnd
+		if cfg.ReasoningContext && !cfg.CompactHistory {
+			// Only in what's sent, the saved conversation keeps the
+			// reasoning apart.
+			messages = append(messages, withReasoning(m.messages, m.reasoning)...)
+		} else {
+			messages = append(messages, m.messages...)
+		}
+		messages = append(messages, userMessage(content))
+		span := m.trace.startSpan("prompt.assemble", nil)
+		messages, err := applyMiddlewares(messages, m.promptMiddlewares(cfg, mod))
+		span.set("mods.messages", len(messages))
+		span.finish(err)
+		if err != nil {
+			return err
+		}
+		if i := lastUserMessage(messages); i >= 0 {
+			content = messages[i].Content
+		}
+		if cfg.showsBudget() {
+			m.budget = m.budgetMeter(messages, mod)
+		}
+		if cfg.ShowUsage {
+			// In case the API doesn't report the usage.
+			m.promptTokens, m.promptExact = countMessageTokens(mod.Name, messages)
+		}
+		if cfg.PromptOnly {
+			return assembledPrompt{formatPrompt(messages)}
+		}
+
+		// Until the end of the stream, with the time of the first token.
+		m.request = m.trace.startSpan("completion", nil)
+		m.request.set("mods.api", mod.API)
+		m.request.set("mods.model", mod.Name)
+		m.request.set("mods.retries", m.retries)
+		if mod.API == mockAPI {
+			return mockCompletion(ctx, cfg.APIs[mockAPI], content)
 		}
-		ccfg := openai.DefaultConfig(key)
 		api, ok := cfg.APIs[mod.API]
 		if !ok {
-			eps := make([]string, 0)
-			for k := range cfg.APIs {
-				eps = append(eps, m.styles.inlineCode.Render(k))
+			return m.unknownAPIError(mod.API)
+		}
+		key, err := m.apiKey(mod.API, api)
+		if err != nil {
+			var me modsError
+			if errors.As(err, &me) && m.canSetup() {
+				return setupStart{me}
 			}
-			return modsError{
-				reason: fmt.Sprintf("The API endpoint %s is not configured ", m.styles.inlineCode.Render(cfg.API)),
-				err:    fmt.Errorf("Your configured API endpoints are: %s", eps),
+			return err
+		}
+		ccfg := openai.DefaultConfig(key)
+		if api.RequestsPerMinute > 0 {
+			if err := waitRateLimit(ctx, mod.API, api.RequestsPerMinute); err != nil {
+				return modsError{err, "Stopped waiting for the rate limit."}
 			}
 		}
 		ccfg.BaseURL = api.BaseURL
-		client := openai.NewClientWithConfig(ccfg)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		prefix := cfg.Prefix
-		if cfg.Markdown {
-			prefix = fmt.Sprintf("%s %s", prefix, markdownPrefix)
+		params := api.extraParams()
+		if cfg.Web {
+			for k, v := range api.webSearchParams() {
+				params[k] = v
+			}
 		}
-		if prefix != "" {
-			content = strings.TrimSpace(prefix + "\n\n" + content)
+		if cfg.reportsUsage() && !cfg.NoStream && api.streams() {
+			// Streamed responses only report their usage if asked to.
+			params["stream_options"] = map[string]any{"include_usage": true}
 		}
-
-		if !cfg.NoLimit {
-			if len(content) > mod.MaxChars {
-				content = content[:mod.MaxChars]
+		if cfg.UseTools {
+			params["tools"] = cfg.toolDefinitions()
+			if len(m.toolTurns) > 0 {
+				params["messages"] = withToolTurns(messages, m.toolTurns)
 			}
 		}
-
-		resp, err := client.CreateChatCompletion(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:       mod.Name,
-				Temperature: noOmitFloat(cfg.Temperature),
-				TopP:        noOmitFloat(cfg.TopP),
-				MaxTokens:   cfg.MaxTokens,
-				Messages: []openai.ChatCompletionMessage{
-					{
-						Role:    openai.ChatMessageRoleUser,
-						Content: content,
+		if cfg.Logprobs {
+			if _, native := backends[mod.API]; !native && !hasCapability(modelCapabilities(ctx, cfg, api, mod, key), capLogprobs) {
+				m.warning = fmt.Sprintf("The %s model doesn't support logprobs, they may be missing.", mod.Name)
+			}
+			params["logprobs"] = true
+			if cfg.TopLogprobs > 0 {
+				params["top_logprobs"] = cfg.TopLogprobs
+			}
+		}
+		extras := &responseExtras{}
+		ccfg.HTTPClient = &http.Client{
+			Transport: extrasTransport{
+				extras: extras,
+				base: paramsTransport{
+					params: params,
+					base: userAgentTransport{
+						agent: cfg.userAgent(),
+						base:  sseTransport{checkResponseTransport{baseTransport()}},
 					},
 				},
 			},
-		)
+		}
+		client := openai.NewClientWithConfig(ccfg)
+
+		if cfg.MaxInputBytes > 0 && !cfg.Yes {
+			var size int64
+			for _, msg := range messages {
+				size += int64(len(msg.Content))
+			}
+			if size > cfg.MaxInputBytes {
+				return modsError{
+					reason: fmt.Sprintf("The prompt is %s, over the limit of %s.", formatBytes(size), formatBytes(cfg.MaxInputBytes)),
+					err:    fmt.Errorf("Use %s to send it anyway, or change %s in the settings.", m.styles.inlineCode.Render("--yes"), m.styles.inlineCode.Render("max-input-bytes")),
+				}
+			}
+		}
+
+		if b, ok := backends[mod.API]; ok {
+			if w := backendWarning(b, cfg); w != "" {
+				m.warning = w
+			}
+			return b.completion(ctx, m, api, mod, key, messages)
+		}
+
+		logitBias, err := parseLogitBias(mod.Name, cfg.LogitBias)
+		if err != nil {
+			return modsError{withExitCode(err, exitConfig), "There was an error in your logit bias."}
+		}
+		req := openai.ChatCompletionRequest{
+			Model:            mod.Name,
+			Temperature:      noOmitFloat(cfg.Temperature),
+			TopP:             noOmitFloat(cfg.TopP),
+			MaxTokens:        cfg.MaxTokens,
+			Messages:         messages,
+			LogitBias:        logitBias,
+			PresencePenalty:  cfg.PresencePenalty,
+			FrequencyPenalty: cfg.FrequencyPenalty,
+			User:             cfg.requestUser(),
+		}
+		var stream completionStream
+		if cfg.Choices > 1 {
+			req.N = cfg.Choices
+		}
+		if cfg.NoStream || !api.streams() || cfg.Choices > 1 {
+			// The responses of --choices come at once.
+			var resp openai.ChatCompletionResponse
+			resp, err = client.CreateChatCompletion(ctx, req)
+			if err == nil {
+				stream = newResponseStream(resp)
+				if cfg.Choices > 1 && len(resp.Choices) < 2 {
+					m.warning = fmt.Sprintf("The API sent a single response for --choices %d, not all of them support it.", cfg.Choices)
+				}
+			}
+		} else {
+			var s *openai.ChatCompletionStream
+			s, err = client.CreateChatCompletionStream(ctx, req)
+			if err == nil {
+				stream = openaiStream{s}
+			}
+		}
 		ae := &openai.APIError{}
 		if errors.As(err, &ae) {
 			switch ae.HTTPStatusCode {
 			case http.StatusNotFound:
 				if mod.Fallback != "" {
 					m.Config.Model = mod.Fallback
-					return m.retry(content, modsError{err: err, reason: "OpenAI API server error."})
+					return m.retry(m.lastInput, modsError{err: err, reason: "OpenAI API server error."})
 				}
 				return modsError{err: err, reason: fmt.Sprintf("Missing model '%s' for API '%s'", cfg.Model, cfg.API)}
 			case http.StatusBadRequest:
@@ -285,7 +855,11 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 					if cfg.NoLimit {
 						return pe
 					}
-					return m.retry(content[:len(content)-10], pe)
+					input, ok := shrinkInput(m.lastInput)
+					if !ok {
+						return pe
+					}
+					return m.retry(input, pe)
 				}
 				// bad request (do not retry)
 				return modsError{err: err, reason: "OpenAI API request error."}
@@ -294,21 +868,40 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 				return modsError{err: err, reason: "Invalid OpenAI API key."}
 			case http.StatusTooManyRequests:
 				// rate limiting or engine overload (wait and retry)
-				return m.retry(content, modsError{err: err, reason: "You’ve hit your OpenAI API rate limit."})
+				return m.retry(m.lastInput, modsError{err: err, reason: "You’ve hit your OpenAI API rate limit."})
 			case http.StatusInternalServerError:
 				if mod.API == "openai" {
-					return m.retry(content, modsError{err: err, reason: "OpenAI API server error."})
+					return m.retry(m.lastInput, modsError{err: err, reason: "OpenAI API server error."})
 				}
 				return modsError{err: err, reason: fmt.Sprintf("Error loading model '%s' for API '%s'", mod.Name, mod.API)}
 			default:
-				return m.retry(content, modsError{err: err, reason: "Unknown OpenAI API error."})
+				return m.retry(m.lastInput, modsError{err: err, reason: "Unknown OpenAI API error."})
 			}
 		}
 
+		ue := unexpectedResponseError{}
+		if errors.As(err, &ue) {
+			return modsError{err: err, reason: "The API answered with an unexpected response."}
+		}
 		if err != nil {
 			return modsError{err: err, reason: "There was a problem with the OpenAI API request."}
 		}
-		return completionOutput{resp.Choices[0].Message.Content}
+		return completionStreamStart{
+			stream: stream,
+			prompt: content,
+			extras: extras,
+		}
+	}
+}
+
+func (m *Mods) unknownAPIError(name string) modsError {
+	eps := make([]string, 0)
+	for k := range m.Config.APIs {
+		eps = append(eps, m.styles.inlineCode.Render(k))
+	}
+	return modsError{
+		reason: fmt.Sprintf("The API endpoint %s is not configured ", m.styles.inlineCode.Render(name)),
+		err:    withExitCode(fmt.Errorf("Your configured API endpoints are: %s", eps), exitConfig),
 	}
 }
 
@@ -324,6 +917,20 @@ func readStdinCmd() tea.Msg {
 	return completionInput{""}
 }
 
+// formatBytes returns the size in a human readable form, e.g. 1.5 MB.
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
 // noOmitFloat converts a 0.0 value to a float usable by the OpenAI client
 // library, which currently uses Float32 fields in the request struct with the
 // omitempty tag. This means we need to use math.SmallestNonzeroFloat32 instead
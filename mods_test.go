@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// toolRound returns a Mods that ran a tool call for the answer, with retries
+// left and every automatic retry on.
+func toolRound() *Mods {
+	return &Mods{
+		Config: config{
+			MaxRetries:        5,
+			RetryOnEmpty:      true,
+			RetryOnDrop:       true,
+			RetryOnTruncation: true,
+		},
+		state:     completionState,
+		extras:    &responseExtras{finishReason: "stop"},
+		toolTurns: []map[string]any{{"role": "tool", "content": "removed 3 files"}},
+	}
+}
+
+func TestRetryAfterToolCalls(t *testing.T) {
+	m := toolRound()
+	if m.canRetry() {
+		t.Error("expected no retry after a tool round")
+	}
+	msg := m.retry("hi", modsError{errors.New("server error"), "OpenAI API server error."})
+	err, ok := msg.(modsError)
+	if !ok {
+		t.Fatalf("got %T, want the error", msg)
+	}
+	if !strings.Contains(err.Error(), "isn't sent again after the tool calls") {
+		t.Errorf("got %q, want it to say why it isn't retried", err.Error())
+	}
+	if m.retries != 0 {
+		t.Errorf("got %d retries, want 0", m.retries)
+	}
+}
+
+func TestRetryBeforeToolCalls(t *testing.T) {
+	m := toolRound()
+	m.toolTurns = nil
+	if !m.canRetry() {
+		t.Error("expected a retry without tool calls")
+	}
+	if msg := m.retry("hi", modsError{errors.New("server error"), "OpenAI API server error."}); m.retries != 1 {
+		t.Errorf("got %d retries and %T, want a retry", m.retries, msg)
+	}
+}
+
+func TestNoRetryOnEmptyAfterToolCalls(t *testing.T) {
+	tempDataHome(t)
+	m := toolRound()
+	m.Update(completionStreamEnd{})
+	if m.retries != 0 {
+		t.Errorf("got %d retries, want 0", m.retries)
+	}
+	if m.warning != emptyResponseNotice {
+		t.Errorf("got warning %q, want %q", m.warning, emptyResponseNotice)
+	}
+}
+
+func TestNoRetryOnDropAfterToolCalls(t *testing.T) {
+	tempDataHome(t)
+	m := toolRound()
+	m.Output = "The files were"
+	m.Update(completionStreamDrop{errors.New("connection reset")})
+	if m.retries != 0 {
+		t.Errorf("got %d retries, want 0", m.retries)
+	}
+	if m.Output != "The files were" {
+		t.Errorf("got output %q, want the partial response", m.Output)
+	}
+	if !strings.Contains(m.warning, "connection dropped") {
+		t.Errorf("got warning %q, want the drop noticed", m.warning)
+	}
+}
+
+func TestRetryRunsTheMiddlewaresOnce(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		first := len(prompts) == 1
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if first {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"slow down","type":"rate_limit"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer srv.Close()
+
+	m := &Mods{
+		trace: newTracer(),
+		Config: config{
+			Model:      "test-model",
+			Prefix:     "explain this",
+			Markdown:   true,
+			MaxRetries: 3,
+			NoStream:   true,
+			Models:     map[string]Model{"test-model": {Name: "test-model", API: "test"}},
+			APIs:       map[string]API{"test": {BaseURL: srv.URL, APIKey: "key"}},
+		},
+	}
+	msg := m.startCompletionCmd("package main")()
+	retry, ok := msg.(completionRetry)
+	if !ok {
+		t.Fatalf("got %T, want a retry", msg)
+	}
+	if retry.content != "package main" {
+		t.Errorf("got retry input %q, want the input before the middlewares", retry.content)
+	}
+	if msg := m.startCompletionCmd(retry.content)(); msg == nil {
+		t.Fatal("expected a response")
+	} else if _, ok := msg.(completionStreamStart); !ok {
+		t.Fatalf("got %#v, want the response", msg)
+	}
+	m.cancelRequest()
+
+	if len(prompts) != 2 {
+		t.Fatalf("got %d requests, want 2", len(prompts))
+	}
+	if prompts[0] != prompts[1] {
+		t.Errorf("the retry sent %q, want the same prompt as the first request, %q", prompts[1], prompts[0])
+	}
+	if n := strings.Count(prompts[1], markdownPrefix); n != 1 {
+		t.Errorf("got the Markdown instruction %d times, want once", n)
+	}
+}
+
+func TestShrinkInput(t *testing.T) {
+	if _, ok := shrinkInput("short"); ok {
+		t.Error("expected nothing to cut")
+	}
+	got, ok := shrinkInput("une chaîne trop longue é")
+	if !ok || got != "une chaîne trop" {
+		t.Errorf("got %q, want %q", got, "une chaîne trop")
+	}
+	for i := 0; i < 20; i++ {
+		s := strings.Repeat("é", i)
+		if got, _ := shrinkInput(s); !utf8.ValidString(got) {
+			t.Errorf("%q cut in the middle of a character: %q", s, got)
+		}
+	}
+}
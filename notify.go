@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gen2brain/beeep"
+)
+
+const maxNotificationChars = 80
+
+// notify shows a desktop notification saying the response to the prompt is
+// ready, with its number of tokens, titled with the title of the
+// conversation if it has one. Systems without a notification service are
+// silently ignored.
+func notify(title, prompt string, tokens int) {
+	prompt = shortenNotification(prompt)
+	msg := "The response is ready"
+	if prompt != "" {
+		msg = "The response to “" + prompt + "” is ready"
+	}
+	if tokens > 0 {
+		msg += fmt.Sprintf(", %s tokens", groupDigits(tokens))
+	}
+	heading := "mods"
+	if title = shortenNotification(title); title != "" {
+		heading = "mods: " + title
+	}
+	_ = beeep.Notify(heading, msg+".", "")
+}
+
+func shortenNotification(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxNotificationChars {
+		s = string(r[:maxNotificationChars-1]) + "…"
+	}
+	return s
+}
+
+// notificationTitle returns the title the conversation is known by so far:
+// the one given with --title, or the one of the continued conversation.
+func (m *Mods) notificationTitle() string {
+	if m.Config.Title != "" {
+		return m.Config.Title
+	}
+	if m.continued != nil {
+		return m.continued.Title
+	}
+	return ""
+}
+
+// responseTokens returns the number of tokens of the response, as reported
+// by the API or counted.
+func (m *Mods) responseTokens(reported int, content string) int {
+	if reported > 0 {
+		return reported
+	}
+	mod := m.Config.Models[m.Config.Model]
+	if mod.Name == "" {
+		mod.Name = m.Config.Model
+	}
+	n, _ := countTokens(mod.Name, content)
+	return n
+}
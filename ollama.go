@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ollamaBackend talks to the native chat API of Ollama, /api/chat.
+type ollamaBackend struct{}
+
+func (ollamaBackend) title() string { return "Ollama" }
+
+// ollamaBaseURL returns the base URL of the Ollama server, without the /v1
+// of its OpenAI compatible API if it's there.
+func ollamaBaseURL(api API) string {
+	return strings.TrimSuffix(strings.TrimSuffix(api.BaseURL, "/"), "/v1")
+}
+
+func (ollamaBackend) completion(ctx context.Context, m *Mods, api API, mod Model, key string, messages []openai.ChatCompletionMessage) tea.Msg {
+	cfg := m.Config
+	content := messages[len(messages)-1].Content
+	chat := make([]map[string]string, 0, len(messages))
+	for _, msg := range messages {
+		chat = append(chat, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	options := map[string]any{
+		"temperature": cfg.Temperature,
+		"top_p":       cfg.TopP,
+	}
+	if cfg.MaxTokens > 0 {
+		options["num_predict"] = cfg.MaxTokens
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":    mod.Name,
+		"messages": chat,
+		"stream":   !cfg.NoStream && api.streams(),
+		"options":  options,
+	})
+	if err != nil {
+		return modsError{err, "Unable to build the Ollama request."}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ollamaBaseURL(api)+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return modsError{err, "Unable to build the Ollama request."}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", cfg.userAgent())
+	if key != "" {
+		// For a server behind a proxy checking the key.
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	extras := &responseExtras{}
+	stream, err := newOllamaStream(req, extras)
+	he := &httpStatusError{}
+	if errors.As(err, &he) {
+		switch he.HTTPStatusCode {
+		case http.StatusNotFound:
+			return modsError{err: err, reason: "Missing model '" + mod.Name + "' for API '" + mod.API + "', pull it with ollama pull."}
+		case http.StatusBadRequest:
+			return modsError{err: err, reason: "Ollama API request error."}
+		default:
+			return m.retry(m.lastInput, modsError{err: err, reason: "Unknown Ollama API error."})
+		}
+	}
+	if err != nil {
+		return modsError{err: err, reason: "There was a problem with the Ollama API request, is it running?"}
+	}
+	return completionStreamStart{stream: stream, prompt: content, extras: extras}
+}
+
+func (ollamaBackend) pingRequest(ctx context.Context, cfg config, api API) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaBaseURL(api)+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cfg.userAgent())
+	return req, nil
+}
+
+// ollamaStream reads the response of /api/chat, a JSON object per line, the
+// last one with done set and the usage.
+type ollamaStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	extras *responseExtras
+}
+
+func newOllamaStream(req *http.Request, extras *responseExtras) (*ollamaStream, error) {
+	resp, err := (&http.Client{Transport: baseTransport()}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(b, &e); err != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(b))
+		}
+		return nil, &httpStatusError{HTTPStatusCode: resp.StatusCode, Body: e.Error}
+	}
+	return &ollamaStream{body: resp.Body, reader: bufio.NewReader(resp.Body), extras: extras}, nil
+}
+
+func (s *ollamaStream) Recv() (string, error) {
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, io.EOF) && s.extras.finishReason == "" {
+				// The last object says it's done.
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		var chunk struct {
+			Message struct {
+				Content  string `json:"content"`
+				Thinking string `json:"thinking"`
+			} `json:"message"`
+			Done            bool   `json:"done"`
+			DoneReason      string `json:"done_reason"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+			Error           string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", err
+		}
+		if chunk.Error != "" {
+			return "", errors.New(chunk.Error)
+		}
+		s.extras.reasoning += chunk.Message.Thinking
+		if chunk.Done {
+			s.extras.finishReason = chunk.DoneReason
+			if s.extras.finishReason == "" {
+				s.extras.finishReason = "stop"
+			}
+			s.extras.promptTokens = chunk.PromptEvalCount
+			s.extras.completionTokens = chunk.EvalCount
+		}
+		return chunk.Message.Content, nil
+	}
+}
+
+func (s *ollamaStream) Close() {
+	_ = s.body.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	codeBlockRe  = regexp.MustCompile("(?s)```[^\n`]*\n(.*?)\n?```")
+	markdownRe   = regexp.MustCompile("(?m)^(#{1,6} |[*+-] |\\d+\\. |> |\\|.*\\|$)|\\*\\*[^*]+\\*\\*|`[^`]+`|\\[[^]]+\\]\\([^)]+\\)")
+	headingRe    = regexp.MustCompile(`^#{1,6}\s+`)
+	blockquoteRe = regexp.MustCompile(`^>\s?`)
+	bulletRe     = regexp.MustCompile(`^(\s*)[*+] `)
+	imageRe      = regexp.MustCompile(`!\[([^]]*)\]\([^)]*\)`)
+	linkRe       = regexp.MustCompile(`\[([^]]+)\]\(([^)]+)\)`)
+	emphasisRe   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__|\*([^*\s][^*]*)\*`)
+	inlineCodeRe = regexp.MustCompile("`([^`]+)`")
+)
+
+// maxProseLines is the most lines of text outside of code blocks a response
+// can have for --as auto to print only its code.
+const maxProseLines = 2
+
+// outputAs returns the response shaped as --as asks.
+func outputAs(as, text string) string {
+	if as == "auto" {
+		as = guessOutputAs(text)
+	}
+	switch as {
+	case "code":
+		return dominantCode(text)
+	case "text":
+		return flattenMarkdown(text)
+	}
+	return strings.TrimSpace(text)
+}
+
+// guessOutputAs picks what --as auto prints: code when the response is code
+// blocks with at most a couple of lines of text around them, markdown when it
+// has headings, lists, emphasis, inline code, links or tables, and text
+// otherwise.
+func guessOutputAs(text string) string {
+	if codeBlockRe.MatchString(text) {
+		prose := 0
+		for _, line := range strings.Split(codeBlockRe.ReplaceAllString(text, ""), "\n") {
+			if strings.TrimSpace(line) != "" {
+				prose++
+			}
+		}
+		if prose <= maxProseLines {
+			return "code"
+		}
+		return "markdown"
+	}
+	if markdownRe.MatchString(text) {
+		return "markdown"
+	}
+	return "text"
+}
+
+// dominantCode returns the content of the longest code block of the text, or
+// the whole text if it has none.
+func dominantCode(text string) string {
+	code := ""
+	for _, m := range codeBlockRe.FindAllStringSubmatch(text, -1) {
+		if len(m[1]) > len(code) {
+			code = m[1]
+		}
+	}
+	if code == "" {
+		return strings.TrimSpace(text)
+	}
+	return code
+}
+
+// flattenMarkdown removes the markdown syntax from the text, keeping the
+// content of the code blocks as is, the targets of the links in parentheses,
+// and the items of the lists as dashes.
+func flattenMarkdown(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	out := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		line = headingRe.ReplaceAllString(line, "")
+		line = blockquoteRe.ReplaceAllString(line, "")
+		line = bulletRe.ReplaceAllString(line, "$1- ")
+		line = imageRe.ReplaceAllString(line, "$1")
+		line = linkRe.ReplaceAllString(line, "$1 ($2)")
+		line = emphasisRe.ReplaceAllString(line, "$1$2$3")
+		line = inlineCodeRe.ReplaceAllString(line, "$1")
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
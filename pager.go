@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
+)
+
+// printOutput prints the output to the terminal, with the wide tables made
+// compact if enabled, and through $PAGER if paging is enabled and the output
+// doesn't fit. Without a usable pager the output is printed as is.
+func printOutput(out string, cfg config) {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		fmt.Println(out)
+		return
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err == nil && cfg.CompactTables {
+		out = compactTables(out, width)
+	}
+	if !cfg.Pager || err != nil || outputHeight(out, width) < height {
+		fmt.Println(out)
+		return
+	}
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		args = []string{"less"}
+	}
+	if filepath.Base(args[0]) == "less" {
+		// Keep the colors of the output.
+		args = append(args, "-R")
+	}
+	c := exec.Command(args[0], args[1:]...) //nolint:gosec
+	c.Stdin = strings.NewReader(out + "\n")
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Println(out)
+	}
+}
+
+// outputHeight returns the number of terminal lines the output takes.
+func outputHeight(out string, width int) int {
+	n := 0
+	for _, line := range strings.Split(out, "\n") {
+		w := lipgloss.Width(line)
+		if width <= 0 || w <= width {
+			n++
+			continue
+		}
+		n += (w + width - 1) / width
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pingTimeout is how long --ping waits for each API.
+const pingTimeout = 10 * time.Second
+
+// pingResult is what --ping found out about an API.
+type pingResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Latency int64  `json:"latency_ms,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// pingAPIs lists the models of the APIs, the one of --api or all of them, at
+// the same time. It returns the results sorted by name.
+func pingAPIs(cfg config) []pingResult {
+	var names []string
+	for name := range cfg.APIs {
+		if cfg.API == "" || name == cfg.API {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	results := make([]pingResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = pingAPI(cfg, name, cfg.APIs[name])
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// pingAPI makes the smallest authenticated request to the API, listing its
+// models, and times it.
+func pingAPI(cfg config, name string, api API) pingResult {
+	result := pingResult{Name: name}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	req, err := pingRequest(ctx, cfg, name, api)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Transport: baseTransport()}).Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	_ = resp.Body.Close()
+	result.Latency = time.Since(start).Milliseconds()
+	if resp.StatusCode != http.StatusOK {
+		result.Error = "unexpected status " + resp.Status
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// pingRequest returns the request listing the models of the API, the one of
+// its backend if it has one, or with the key of the API.
+func pingRequest(ctx context.Context, cfg config, name string, api API) (*http.Request, error) {
+	if b, ok := backends[name]; ok {
+		return b.pingRequest(ctx, cfg, api)
+	}
+	key := api.APIKey
+	if key == "" {
+		key = os.Getenv(apiKeyEnv(name, api))
+	}
+	if _, required := apiKeys[name]; required && key == "" {
+		return nil, fmt.Errorf("%s isn't set", apiKeyEnv(name, api))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(api.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	req.Header.Set("User-Agent", cfg.userAgent())
+	return req, nil
+}
+
+// printPings prints the results of --ping, as JSON with --json.
+func printPings(results []pingResult, s styles, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+	for _, r := range results {
+		name := s.appName.Render(fmt.Sprintf("%-*s", width, r.Name))
+		if r.OK {
+			fmt.Printf("%s  %s %s\n", name, s.flag.Render("ok"), s.comment.Render(fmt.Sprintf("%dms", r.Latency)))
+			continue
+		}
+		fmt.Printf("%s  %s %s\n", name, s.failed.Render("failed"), s.comment.Render(r.Error))
+	}
+	return nil
+}
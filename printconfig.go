@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolvedSettings returns the settings mods uses, with the defaults, the
+// settings file, the environment and the flags applied, in the format of the
+// settings file. The API keys and the credentials in the base URLs are
+// redacted unless showSecrets is set.
+func (c config) resolvedSettings(showSecrets bool) ([]byte, error) {
+	settings := map[string]any{}
+	v := reflect.ValueOf(c)
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		settings[name] = v.Field(i).Interface()
+	}
+	if !showSecrets {
+		apis := make(map[string]API, len(c.APIs))
+		for name, api := range c.APIs {
+			if api.APIKey != "" {
+				api.APIKey = redacted
+			}
+			api.BaseURL = redactURL(api.BaseURL)
+			apis[name] = api
+		}
+		settings["apis"] = apis
+	}
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("unable to print the settings: %w", err)
+	}
+	if len(c.settingsFiles) > 0 {
+		header := "# " + c.SettingsPath + "\n"
+		for _, f := range c.settingsFiles {
+			header += "# " + f + "\n"
+		}
+		b = append([]byte("# Merged from, later files overriding the ones before:\n"+header), b...)
+	}
+	return b, nil
+}
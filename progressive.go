@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// progressiveMode is how --progressive shows the response while it's
+// generated.
+type progressiveMode int
+
+const (
+	// progressiveOff shows the animation, and the response once complete.
+	progressiveOff progressiveMode = iota
+	// progressiveRedraw shows the raw response while it's generated, then
+	// replaces it with the styled one.
+	progressiveRedraw
+	// progressiveAppend prints the raw response as it comes, on terminals
+	// that can't erase it afterwards.
+	progressiveAppend
+)
+
+// progressive returns the mode of --progressive for the terminal. Piped
+// responses, and the ones printed as is or in another format, are printed
+// once complete, like without --progressive.
+func (c config) progressive() progressiveMode {
+	if !c.Progressive || c.Chat || c.Raw || c.NoMarkdown || c.ExtractCode || c.Renderer != "" || c.OutputFormat != "" || !isatty.IsTerminal(os.Stdout.Fd()) {
+		return progressiveOff
+	}
+	if os.Getenv("TERM") == "dumb" || !isatty.IsTerminal(os.Stderr.Fd()) {
+		return progressiveAppend
+	}
+	return progressiveRedraw
+}
+
+// progressiveView shows the raw response received so far, or nothing once
+// it's being appended.
+func (m *Mods) progressiveView() string {
+	if m.Config.progressive() == progressiveAppend {
+		return ""
+	}
+	_, answer := splitThinking(m.Output)
+	if m.width > 0 {
+		return m.renderer.NewStyle().Width(m.width).Render(answer)
+	}
+	return answer
+}
+
+// wrapsResponse returns whether the response is shown while it's generated,
+// wrapped to the width of the terminal.
+func (m *Mods) wrapsResponse() bool {
+	if m.state != completionState {
+		return false
+	}
+	return (m.revealing && m.revealed > 0) || (m.Output != "" && m.Config.progressive() == progressiveRedraw)
+}
+
+// appendLines prints the lines of the response completed so far with
+// progressiveAppend. The rest is printed once the response is done.
+func (m *Mods) appendLines() tea.Cmd {
+	if m.Config.progressive() != progressiveAppend {
+		return nil
+	}
+	rest := m.Output[m.appended:]
+	i := strings.LastIndex(rest, "\n")
+	if i < 0 {
+		return nil
+	}
+	m.appended += i + 1
+	return tea.Println(rest[:i])
+}
+
+// appendedRest returns the part of the response not printed by appendLines.
+func (m *Mods) appendedRest() string {
+	if m.appended > len(m.Output) {
+		return ""
+	}
+	return m.Output[m.appended:]
+}
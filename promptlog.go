@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// promptLogEntry is the line of the history-file for a run of mods.
+type promptLogEntry struct {
+	Time             time.Time `json:"time"`
+	Model            string    `json:"model"`
+	API              string    `json:"api,omitempty"`
+	Role             string    `json:"role,omitempty"`
+	Prompt           string    `json:"prompt"`
+	InputBytes       int       `json:"input_bytes,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// logPrompt appends the run to the history-file, as a line of JSON. The piped
+// input is only logged by its size, the log is meant to be small and easy to
+// grep.
+func (m *Mods) logPrompt() error {
+	path, err := expandHome(m.Config.HistoryFile)
+	if err != nil {
+		return err
+	}
+	entry := promptLogEntry{
+		Time:             m.started,
+		Model:            m.Config.Model,
+		API:              m.Config.Models[m.Config.Model].API,
+		Role:             m.Config.roleName(),
+		Prompt:           m.Config.Prefix,
+		InputBytes:       len(m.Input),
+		PromptTokens:     m.usage.prompt,
+		CompletionTokens: m.usage.completion,
+	}
+	if m.Error != nil {
+		entry.Error = m.Error.reason
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:gomnd
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
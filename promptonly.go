@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// assembledPrompt is a tea.Msg that wraps the prompt printed by
+// --prompt-only instead of being sent.
+type assembledPrompt struct{ text string }
+
+// formatPrompt returns the messages of the request as text, each under its
+// role.
+func formatPrompt(messages []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "%s:\n%s\n\n", msg.Role, strings.TrimSpace(msg.Content))
+	}
+	return strings.TrimSpace(b.String())
+}
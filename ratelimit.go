@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// Times of the last requests made to the APIs with a requests-per-minute, by
+// name. They're kept in the state directory so consecutive runs are paced
+// too, and in memory if it can't be written.
+var (
+	//nolint: gochecknoglobals
+	requestTimesMu sync.Mutex
+	requestTimes   = map[string]time.Time{}
+)
+
+func requestTimesPath() (string, error) {
+	return xdg.StateFile(filepath.Join("mods", "requests.json"))
+}
+
+func loadRequestTimes() map[string]time.Time {
+	path, err := requestTimesPath()
+	if err != nil {
+		return requestTimes
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return requestTimes
+	}
+	times := map[string]time.Time{}
+	if err := json.Unmarshal(b, &times); err != nil {
+		return requestTimes
+	}
+	for name, t := range requestTimes {
+		if t.After(times[name]) {
+			times[name] = t
+		}
+	}
+	return times
+}
+
+func saveRequestTimes(times map[string]time.Time) {
+	requestTimes = times
+	path, err := requestTimesPath()
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(times)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, b, 0o600) //nolint:gomnd
+}
+
+// waitRateLimit waits until the next request to the API can be made, one
+// every minute/rpm, counting the ones of the previous runs of mods.
+func waitRateLimit(ctx context.Context, name string, rpm int) error {
+	interval := time.Minute / time.Duration(rpm)
+	requestTimesMu.Lock()
+	times := loadRequestTimes()
+	next := time.Now()
+	if last, ok := times[name]; ok && last.Add(interval).After(next) {
+		next = last.Add(interval)
+	}
+	// The time is taken before waiting, so the next requests queue after it.
+	times[name] = next
+	saveRequestTimes(times)
+	requestTimesMu.Unlock()
+
+	wait := time.Until(next)
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rawRequestCmd posts the JSON request body of the --raw-request file as is
+// to the chat completions endpoint of the API, only adding the headers, and
+// reads the response.
+func (m *Mods) rawRequestCmd() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelRequest = cancel
+	return func() tea.Msg {
+		cfg := m.Config
+		body, err := os.ReadFile(cfg.RawRequest)
+		if err != nil {
+			return modsError{err, "Unable to read the raw request."}
+		}
+		var fields struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return modsError{withExitCode(err, exitConfig), "The raw request isn't valid JSON."}
+		}
+
+		// The API is the one of the model of the request if it's known.
+		mod, ok := cfg.Models[fields.Model]
+		if !ok {
+			mod = cfg.Models[cfg.Model]
+		}
+		if cfg.API != "" {
+			mod.API = cfg.API
+		}
+		api, ok := cfg.APIs[mod.API]
+		if !ok {
+			return m.unknownAPIError(mod.API)
+		}
+		if b, ok := backends[mod.API]; ok {
+			return modsError{
+				reason: fmt.Sprintf("Raw requests aren't supported by the %s API.", b.title()),
+				err:    withExitCode(errors.New("Use --api to send the request to an OpenAI compatible API."), exitConfig),
+			}
+		}
+
+		url := strings.TrimSuffix(api.BaseURL, "/") + "/chat/completions"
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return modsError{err, "Unable to build the raw request."}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", cfg.userAgent())
+		key, err := m.apiKey(mod.API, api)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp, err := (&http.Client{Transport: sseTransport{checkResponseTransport{baseTransport()}}}).Do(req)
+		ue := unexpectedResponseError{}
+		if errors.As(err, &ue) {
+			return modsError{err, "The API answered with an unexpected response."}
+		}
+		if err != nil {
+			return modsError{err, "There was a problem with the raw request."}
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer func() { _ = resp.Body.Close() }()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096)) //nolint:gomnd
+			return modsError{
+				reason: "The API refused the raw request.",
+				err:    &httpStatusError{resp.StatusCode, strings.TrimSpace(string(msg))},
+			}
+		}
+		return completionStreamStart{
+			stream: &rawStream{body: resp.Body, reader: bufio.NewReader(resp.Body), streaming: fields.Stream},
+			prompt: string(body),
+		}
+	}
+}
+
+// httpStatusError is an unsuccessful response to a raw request.
+type httpStatusError struct {
+	HTTPStatusCode int
+	Body           string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.HTTPStatusCode, e.Body)
+}
+
+// rawStream reads the response to a raw request, streamed or not.
+type rawStream struct {
+	body      io.ReadCloser
+	reader    *bufio.Reader
+	streaming bool
+	done      bool
+}
+
+func (s *rawStream) Recv() (string, error) {
+	if s.done {
+		return "", io.EOF
+	}
+	if !s.streaming {
+		s.done = true
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.NewDecoder(s.reader).Decode(&resp); err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", nil
+		}
+		return resp.Choices[0].Message.Content, nil
+	}
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 && err != nil {
+			return "", err
+		}
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data: ")) {
+			continue
+		}
+		data := bytes.TrimPrefix(line, []byte("data: "))
+		if string(data) == "[DONE]" {
+			s.done = true
+			return "", io.EOF
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return "", err
+		}
+		if len(chunk.Choices) == 0 {
+			return "", nil
+		}
+		return chunk.Choices[0].Delta.Content, nil
+	}
+}
+
+func (s *rawStream) Close() {
+	_ = s.body.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+// secretPatterns match common API key and token formats.
+var secretPatterns = []string{
+	`sk-[A-Za-z0-9_-]{20,}`,                                // OpenAI, Anthropic
+	`gsk_[A-Za-z0-9]{20,}`,                                 // Groq
+	`pplx-[A-Za-z0-9]{20,}`,                                // Perplexity
+	`(?:AKIA|ASIA)[0-9A-Z]{16}`,                            // AWS access keys
+	`gh[pousr]_[A-Za-z0-9]{36,}`,                           // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{22,}`,                         // GitHub fine-grained tokens
+	`glpat-[A-Za-z0-9_-]{20,}`,                             // GitLab tokens
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,                         // Slack tokens
+	`AIza[0-9A-Za-z_-]{35}`,                                // Google API keys
+	`[rs]k_live_[A-Za-z0-9]{24,}`,                          // Stripe keys
+	`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`, // JWTs
+	// Private keys
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// redactor replaces the secrets matched by its patterns.
+type redactor []*regexp.Regexp
+
+// newRedactor compiles the given patterns, along with the built-in secret
+// patterns if builtin is set.
+func newRedactor(patterns []string, builtin bool) (redactor, error) {
+	if builtin {
+		patterns = append(patterns, secretPatterns...)
+	}
+	r := make(redactor, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r = append(r, re)
+	}
+	return r, nil
+}
+
+// redacting returns whether secrets are redacted from the prompt.
+func (c config) redacting() bool {
+	return c.RedactSecrets || len(c.Redact) > 0
+}
+
+func redactionsNotice(n int) string {
+	if n == 1 {
+		return "Redacted 1 secret from the prompt."
+	}
+	return fmt.Sprintf("Redacted %d secrets from the prompt.", n)
+}
+
+// redact returns s with the secrets replaced, and how many were found.
+func (r redactor) redact(s string) (string, int) {
+	n := 0
+	for _, re := range r {
+		s = re.ReplaceAllStringFunc(s, func(string) string {
+			n++
+			return redacted
+		})
+	}
+	return s, n
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const refinePrompt = `Critique your response above: look for mistakes,
+missing details and unclear parts. Then write an improved version of it. Reply
+with the improved response only, without the critique.`
+
+// refineCmd asks the model to improve the response it just gave, keeping the
+// response as an intermediate step. It returns nil once --depth refinements
+// were made, or if the response was stopped.
+func (m *Mods) refineCmd(out completionOutput) tea.Cmd {
+	if m.Config.Chat || m.stopped || len(m.steps) >= m.Config.Depth {
+		return nil
+	}
+	m.steps = append(m.steps, out.content)
+	m.messages = append(m.messages, userMessage(out.prompt), assistantMessage(out.content))
+	return m.startCompletionCmd(refinePrompt)
+}
+
+// formatSteps returns the intermediate responses of the refinement, shown
+// with --verbose.
+func formatSteps(s styles, steps []string) string {
+	var b strings.Builder
+	for i, step := range steps {
+		header := s.comment.Render(fmt.Sprintf("# Step %d of %d", i+1, len(steps)+1))
+		fmt.Fprintf(&b, "%s\n\n%s\n\n", header, strings.TrimSpace(step))
+	}
+	return b.String()
+}
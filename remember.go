@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	flag "github.com/spf13/pflag"
+)
+
+// remembered are the model and role last given with --model and --role, used
+// by default in the next runs.
+type remembered struct {
+	Model string `json:"model,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+func rememberedPath() (string, error) {
+	return xdg.StateFile(filepath.Join("mods", "remembered.json"))
+}
+
+func loadRemembered() (remembered, error) {
+	var r remembered
+	path, err := rememberedPath()
+	if err != nil {
+		return r, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(b, &r)
+}
+
+func saveRemembered(r remembered) error {
+	path, err := rememberedPath()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600) //nolint:gomnd
+}
+
+// remember uses the model and role of the last runs, unless they're given
+// with a flag or the environment, in which case they're the ones to remember,
+// or set in the settings. A remembered model or role that isn't in the
+// settings anymore is forgotten.
+func (c *config) remember() {
+	r, err := loadRemembered()
+	if err != nil {
+		return
+	}
+	var used []string
+	switch {
+	case flag.CommandLine.Changed("model"):
+		r.Model = c.Model
+	case os.Getenv("MODS_MODEL") != "" || r.Model == "" || c.Model != "":
+	default:
+		if _, ok := c.Models[c.resolveModel(r.Model)]; !ok {
+			r.Model = ""
+			break
+		}
+		c.Model = r.Model
+		used = append(used, "the model "+r.Model)
+	}
+	switch {
+	case flag.CommandLine.Changed("role"):
+		r.Role = c.Role
+	case os.Getenv("MODS_ROLE") != "" || r.Role == "" || c.Role != "":
+	default:
+		if !c.isRole(r.Role) {
+			r.Role = ""
+			break
+		}
+		c.Role = r.Role
+		used = append(used, "the role "+r.Role)
+	}
+	c.remembered = &r
+	if len(used) > 0 {
+		c.rememberNotice = "Using " + strings.Join(used, " and ") + " of the last runs, --no-remember to not."
+	}
+}
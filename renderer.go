@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// renderOutput prints the output through the renderer command, which gets
+// the output on its standard input and prints the rendered version itself.
+func renderOutput(renderer, out string) error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	c := exec.Command(shell, flag, renderer) //nolint:gosec
+	c.Stdin = strings.NewReader(out + "\n")
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
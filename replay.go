@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// replayConversation returns the conversation to show with --replay or
+// --replay-last.
+func (c config) replayConversation() (conversation, error) {
+	if c.ReplayLast {
+		return lastConversation()
+	}
+	return findConversation(c.Replay)
+}
+
+// formatTranscript renders the conversation the way the chat shows it, the
+// user messages after a styled prompt and the responses as they came. With
+// showReasoning, the reasoning behind the responses is shown before them.
+func formatTranscript(s styles, c conversation, showReasoning bool) string {
+	var b strings.Builder
+	b.WriteString(s.comment.Render(conversationSummary(c)) + "\n\n")
+	for i, msg := range c.Messages {
+		if r := c.Reasoning[i]; showReasoning && r != "" {
+			b.WriteString(formatThinking(s, r) + "\n")
+		}
+		content := strings.TrimSpace(msg.Content)
+		switch msg.Role {
+		case openai.ChatMessageRoleUser:
+			b.WriteString(formatUserTurn(s, content) + "\n\n")
+		case openai.ChatMessageRoleAssistant:
+			b.WriteString(content + "\n\n")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// formatUserTurn renders a message of the user in a transcript.
+func formatUserTurn(s styles, content string) string {
+	return s.flag.Render("> ") + strings.TrimSpace(content)
+}
+
+// echo returns whether --echo prints the prompt before the response. The
+// JSON outputs are left alone, and the chat shows the prompts already.
+func (c config) echo() bool {
+	return c.Echo && !c.Chat && c.OutputFormat == ""
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// revealTick is a tea.Msg sent each time a word of the streamed response
+// should be revealed with --reveal-rate.
+type revealTick struct{}
+
+func (m *Mods) revealTickCmd() tea.Cmd {
+	return tea.Tick(time.Minute/time.Duration(m.Config.RevealRate), func(time.Time) tea.Msg {
+		return revealTick{}
+	})
+}
+
+// startReveal starts revealing the streamed response at the configured
+// rate, if any.
+func (m *Mods) startReveal() tea.Cmd {
+	m.revealed = 0
+	m.pendingOutput = nil
+	m.revealing = m.Config.RevealRate > 0
+	if !m.revealing {
+		return nil
+	}
+	return m.revealTickCmd()
+}
+
+// updateReveal reveals the next word, finishing the response once the
+// stream is complete and every word was shown. When the stream is behind,
+// it waits for the next words rather than showing them all at once later.
+func (m *Mods) updateReveal() tea.Cmd {
+	if !m.revealing {
+		return nil
+	}
+	_, answer := splitThinking(m.Output)
+	words := countWords(answer)
+	if last, _ := utf8.DecodeLastRuneInString(answer); m.pendingOutput == nil && answer != "" && !unicode.IsSpace(last) {
+		// The last word may not be whole yet.
+		words--
+	}
+	if m.revealed < words {
+		m.revealed++
+	}
+	if m.pendingOutput != nil && m.revealed >= countWords(m.pendingOutput.content) {
+		return m.flushReveal()
+	}
+	return m.revealTickCmd()
+}
+
+// flushReveal stops pacing the response, finishing it right away if the
+// stream is already complete.
+func (m *Mods) flushReveal() tea.Cmd {
+	m.revealing = false
+	if out := m.pendingOutput; out != nil {
+		m.pendingOutput = nil
+		return m.finishCompletion(*out)
+	}
+	return nil
+}
+
+func (m *Mods) revealView() string {
+	_, answer := splitThinking(m.Output)
+	s := revealedWords(answer, m.revealed)
+	if m.width > 0 {
+		return m.renderer.NewStyle().Width(m.width).Render(s)
+	}
+	return s
+}
+
+func countWords(s string) int {
+	n := 0
+	inWord := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			n++
+		}
+	}
+	return n
+}
+
+// revealedWords returns s up to the end of its nth word, nothing for n <= 0.
+func revealedWords(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	inWord := false
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if inWord {
+				n--
+				if n <= 0 {
+					return s[:i]
+				}
+			}
+			inWord = false
+		} else {
+			inWord = true
+		}
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestRevealedWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello world", 0, ""},
+		{"hel", 0, ""},
+		{"hello world", -1, ""},
+		{"hello world", 1, "hello"},
+		{"hello world", 2, "hello world"},
+		{"hello world", 5, "hello world"},
+		{"  hello\n\nworld  ", 1, "  hello"},
+	}
+	for _, tt := range tests {
+		if got := revealedWords(tt.s, tt.n); got != tt.want {
+			t.Errorf("revealedWords(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateRevealWaitsForWholeWords(t *testing.T) {
+	m := &Mods{revealing: true, Config: config{RevealRate: 600}}
+	m.Output = "Hello wor"
+	for i := 0; i < 5; i++ {
+		m.updateReveal()
+	}
+	if m.revealed != 1 {
+		t.Errorf("got %d words revealed, want 1 while the second is streamed", m.revealed)
+	}
+	if got := revealedWords(m.Output, m.revealed); got != "Hello" {
+		t.Errorf("got %q revealed, want %q", got, "Hello")
+	}
+	m.Output = "Hello world "
+	m.updateReveal()
+	if m.revealed != 2 {
+		t.Errorf("got %d words revealed, want 2", m.revealed)
+	}
+}
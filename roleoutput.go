@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// roleName returns the name of the role in use, if any.
+func (c config) roleName() string {
+	switch {
+	case c.Commit:
+		return "commit"
+	case c.Explain:
+		return "explain"
+	case c.Fix:
+		return "fix"
+	case c.Diagnose:
+		return "diagnose"
+	}
+	return c.Role
+}
+
+// roleOutput returns where the responses of the role in use go, its output
+// for the roles of the settings and role-outputs for the built-in ones:
+// stdout, the default, clipboard, or a file the responses are appended to.
+func (c config) roleOutput() string {
+	if r, ok := c.customRole(); ok && r.Output != "" {
+		return r.Output
+	}
+	if _, ok := builtinRoles[c.roleName()]; !ok {
+		return "stdout"
+	}
+	if out, ok := c.RoleOutputs[c.roleName()]; ok && out != "" {
+		return out
+	}
+	return "stdout"
+}
+
+// appendToRoleOutput appends the response to the file of role-outputs, a
+// template where {{.Today}} is today's date as 2006-01-02, and returns its
+// path.
+func appendToRoleOutput(cfg config, response string) (string, error) {
+	vars, err := cfg.templateVars()
+	if err != nil {
+		return "", err
+	}
+	vars["Today"] = time.Now().Format("2006-01-02")
+	path, err := expandTemplate(cfg.roleOutput(), vars)
+	if err != nil {
+		return "", err
+	}
+	if path, err = expandHome(path); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:gomnd
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gomnd
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(strings.TrimRight(response, "\n") + "\n\n"); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
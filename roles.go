@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Role is a role of the settings, used with --role like the built-in ones.
+// Its prompt, if any, is a template wrapping the message sent, with the
+// piped input as {{.Input}}, the prompt given as arguments as {{.Args}} and
+// the environment variables as {{.Env.NAME}}, along with the variables of
+// --var.
+type Role struct {
+	System      string   `yaml:"system"`
+	Prompt      string   `yaml:"prompt"`
+	Model       string   `yaml:"model"`
+	Temperature *float32 `yaml:"temp"`
+	Format      *bool    `yaml:"format"`
+	// Output is where the responses go besides stdout, like the role-outputs
+	// of the built-in roles.
+	Output string `yaml:"output"`
+}
+
+// customRole returns the role of the settings in use, if any.
+func (c config) customRole() (Role, bool) {
+	if _, ok := builtinRoles[c.roleName()]; ok {
+		return Role{}, false
+	}
+	r, ok := c.Roles[c.roleName()]
+	return r, ok
+}
+
+// isRole reports whether there's a built-in role or a role of the settings
+// with that name.
+func (c config) isRole(name string) bool {
+	if _, ok := builtinRoles[name]; ok {
+		return true
+	}
+	_, ok := c.Roles[name]
+	return ok
+}
+
+// applyRole uses the model, temperature and format of the role of the
+// settings in use, unless they were given as flags.
+func (c *config) applyRole() {
+	r, ok := c.customRole()
+	if !ok {
+		return
+	}
+	if r.Model != "" && !flag.CommandLine.Changed("model") {
+		c.Model = r.Model
+	}
+	if r.Temperature != nil && !flag.CommandLine.Changed("temp") {
+		c.Temperature = *r.Temperature
+	}
+	if r.Format != nil && !flag.CommandLine.Changed("format") {
+		c.Markdown = *r.Format
+	}
+}
+
+// rolePrompt renders the prompt template of the role with the prompt given
+// as arguments and the input.
+func (c config) rolePrompt(tmpl, args, input string) (string, error) {
+	vars, err := c.templateVars()
+	if err != nil {
+		return "", err
+	}
+	data := make(map[string]any, len(vars)+3) //nolint:gomnd
+	for k, v := range vars {
+		data[k] = v
+	}
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	data["Env"] = env
+	data["Args"] = args
+	data["Input"] = input
+	t, err := template.New(c.roleName()).Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("the prompt of the role %s: %w", c.roleName(), err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("the prompt of the role %s: %w", c.roleName(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// listRoles prints the built-in roles and the roles of the settings.
+func listRoles(cfg config, s styles) {
+	for _, name := range cfg.roleNames() {
+		r, ok := cfg.Roles[name]
+		if !ok {
+			fmt.Printf("%s %s\n", s.appName.Render(name), s.comment.Render("(built-in)"))
+			continue
+		}
+		var details []string
+		if r.Model != "" {
+			details = append(details, "model "+r.Model)
+		}
+		if r.Temperature != nil {
+			details = append(details, fmt.Sprintf("temp %g", *r.Temperature))
+		}
+		if r.Prompt != "" {
+			details = append(details, "prompt template")
+		}
+		line := s.appName.Render(name)
+		if len(details) > 0 {
+			line += " " + s.comment.Render("("+strings.Join(details, ", ")+")")
+		}
+		fmt.Println(line)
+		if system := firstLine(r.System); system != "" {
+			fmt.Printf("  %s\n", system)
+		}
+	}
+}
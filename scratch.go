@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// scratchTitle is the reserved title of the conversation --scratch keeps
+// adding to.
+const scratchTitle = "__scratch__"
+
+// scratchConversation returns the scratch conversation, and whether it was
+// started yet.
+func scratchConversation() (conversation, bool, error) {
+	ids, err := conversationIDs()
+	if err != nil {
+		return conversation{}, false, err
+	}
+	for _, id := range ids {
+		c, err := readConversation(id)
+		if err == nil && strings.EqualFold(c.Title, scratchTitle) {
+			return c, true, nil
+		}
+	}
+	return conversation{}, false, nil
+}
+
+// resetScratch deletes the scratch conversation, returning whether there was
+// one.
+func resetScratch() (bool, error) {
+	c, ok, err := scratchConversation()
+	if err != nil || !ok {
+		return false, err
+	}
+	path, err := conversationPath(c.ID)
+	if err != nil {
+		return false, err
+	}
+	return true, os.Remove(path)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sentenceAbbreviations end with a period without ending the sentence.
+var sentenceAbbreviations = map[string]bool{
+	"e.g.": true, "i.e.": true, "etc.": true, "vs.": true, "cf.": true,
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "st.": true,
+	"no.": true, "fig.": true, "approx.": true,
+}
+
+// firstSentences returns the first n sentences of the plain text of the
+// response, followed by an ellipsis when there were more.
+func firstSentences(text string, n int) string {
+	text = strings.Join(strings.Fields(flattenMarkdown(text)), " ")
+	runes := []rune(text)
+	count := 0
+	for i, r := range runes {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		end := i + 1
+		// Closing quotes and parentheses belong to the sentence.
+		for end < len(runes) && strings.ContainsRune(`"')]”’`, runes[end]) {
+			end++
+		}
+		if end < len(runes) && runes[end] != ' ' {
+			// Like the decimal point of 3.14, or the dots of a path.
+			continue
+		}
+		if r == '.' && sentenceAbbreviations[strings.ToLower(lastWord(runes[:i+1]))] {
+			continue
+		}
+		if end < len(runes) && end+1 < len(runes) && unicode.IsLower(runes[end+1]) {
+			// The next word doesn't start a sentence.
+			continue
+		}
+		count++
+		if count == n {
+			rest := strings.TrimSpace(string(runes[end:]))
+			if rest == "" {
+				return string(runes[:end])
+			}
+			return string(runes[:end]) + " …"
+		}
+	}
+	return text
+}
+
+// lastWord returns the last word of the runes.
+func lastWord(runes []rune) string {
+	start := len(runes)
+	for start > 0 && runes[start-1] != ' ' {
+		start--
+	}
+	return string(runes[start:])
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+	"gopkg.in/yaml.v3"
+)
+
+// setupStep is the question the first run setup is asking.
+type setupStep int
+
+const (
+	setupAPI setupStep = iota
+	setupModel
+	setupKey
+)
+
+// setup is the state of the first run setup, started when the API of the
+// model has no key: it asks for the API to use, its model and its key, and
+// saves them to the settings file.
+type setup struct {
+	step    setupStep
+	cause   modsError
+	choices []string
+	cursor  int
+	api     string
+	model   string
+	key     textinput.Model
+}
+
+// setupStart starts the first run setup instead of failing with the error.
+type setupStart struct{ cause modsError }
+
+// setupSaved is sent once the choices of the setup are in the settings file.
+type setupSaved struct{ api, model, key string }
+
+// canSetup reports whether the missing key of an API can be asked for
+// instead of failing: the setup runs once, in a terminal, outside of the chat
+// mode. The prompt can still be piped, the keys are read from the terminal.
+func (m *Mods) canSetup() bool {
+	return m.setup == nil && !m.Config.Chat && m.Config.SettingsPath != "" &&
+		m.Config.ErrorFormat != "json" &&
+		m.terminal && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// startSetup asks for the API to use, the ones requiring a key first, with the
+// API of the model on top.
+func (m *Mods) startSetup(cause modsError) tea.Cmd {
+	current := m.Config.Models[m.Config.Model].API
+	var apis []string
+	for name, api := range m.Config.APIs {
+		if _, ok := apiKeys[name]; ok && len(api.Models) > 0 {
+			apis = append(apis, name)
+		}
+	}
+	sort.Slice(apis, func(i, j int) bool {
+		if (apis[i] == current) != (apis[j] == current) {
+			return apis[i] == current
+		}
+		return apis[i] < apis[j]
+	})
+	if len(apis) == 0 {
+		return func() tea.Msg { return cause }
+	}
+	m.setup = &setup{step: setupAPI, cause: cause, choices: apis}
+	m.state = setupState
+	return nil
+}
+
+// updateSetup handles the keys pressed during the setup. Leaving it shows the
+// error it was started for.
+func (m *Mods) updateSetup(msg tea.KeyMsg) tea.Cmd {
+	s := m.setup
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		return func() tea.Msg { return s.cause }
+	}
+	if s.step == setupKey {
+		if msg.Type != tea.KeyEnter {
+			var cmd tea.Cmd
+			s.key, cmd = s.key.Update(msg)
+			return cmd
+		}
+		key := strings.TrimSpace(s.key.Value())
+		if key == "" {
+			return nil
+		}
+		return saveSetupCmd(m.Config.SettingsPath, s.api, s.model, key)
+	}
+	switch msg.String() {
+	case "up", "k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down", "j":
+		if s.cursor < len(s.choices)-1 {
+			s.cursor++
+		}
+	case "enter":
+		choice := s.choices[s.cursor]
+		if s.step == setupAPI {
+			s.api = choice
+			s.choices = s.models(m.Config)
+			s.cursor = 0
+			s.step = setupModel
+			return nil
+		}
+		s.model = choice
+		s.step = setupKey
+		s.key = textinput.New()
+		s.key.Prompt = m.styles.flag.Render("> ")
+		s.key.Placeholder = apiKeyEnv(s.api, m.Config.APIs[s.api])
+		s.key.EchoMode = textinput.EchoPassword
+		s.key.CharLimit = 0
+		return s.key.Focus()
+	}
+	return nil
+}
+
+// models returns the models of the chosen API, the default model first.
+func (s *setup) models(cfg config) []string {
+	var models []string
+	for name := range cfg.APIs[s.api].Models {
+		models = append(models, name)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if (models[i] == cfg.Model) != (models[j] == cfg.Model) {
+			return models[i] == cfg.Model
+		}
+		return models[i] < models[j]
+	})
+	return models
+}
+
+// finishSetup uses the saved choices and sends the prompt again.
+func (m *Mods) finishSetup(msg setupSaved) tea.Cmd {
+	api := m.Config.APIs[msg.api]
+	api.APIKey = msg.key
+	m.Config.APIs[msg.api] = api
+	m.Config.Model = msg.model
+	m.Config.API = ""
+	m.state = completionState
+	notice := fmt.Sprintf("Saved the %s key and %s as the default model to %s.", msg.api, msg.model, m.Config.SettingsPath)
+	return tea.Sequence(
+		tea.Println(m.styles.comment.Render(notice)+"\n"),
+		tea.Batch(m.anim.Init(), m.startCompletionCmd(m.lastInput)),
+	)
+}
+
+// setupView shows the question being asked.
+func (m *Mods) setupView() string {
+	s := m.setup
+	var b strings.Builder
+	b.WriteString("\n" + m.styles.errorDetails.Render(s.cause.reason) + "\n\n")
+	switch s.step {
+	case setupAPI:
+		b.WriteString("Which API do you want to use?\n\n")
+	case setupModel:
+		b.WriteString("Which " + s.api + " model do you want to use by default?\n\n")
+	case setupKey:
+		b.WriteString("Paste your " + s.api + " API key")
+		if ak, ok := apiKeys[s.api]; ok {
+			b.WriteString(", you can grab one at " + m.styles.link.Render(strings.TrimSuffix(ak.url, ".")))
+		}
+		b.WriteString(":\n\n" + s.key.View() + "\n\n")
+		b.WriteString(m.styles.comment.Render("enter to save to the settings, esc to quit") + "\n")
+		return b.String()
+	}
+	for i, choice := range s.choices {
+		if i == s.cursor {
+			b.WriteString(m.styles.flag.Render("> "+choice) + "\n")
+			continue
+		}
+		b.WriteString("  " + choice + "\n")
+	}
+	b.WriteString("\n" + m.styles.comment.Render("↑/↓ to choose, enter to select, esc to quit") + "\n")
+	return b.String()
+}
+
+// saveSetupCmd writes the key of the API, and the model as the default one,
+// to the settings file.
+func saveSetupCmd(path, api, model, key string) tea.Cmd {
+	return func() tea.Msg {
+		if err := saveSetup(path, api, model, key); err != nil {
+			return modsError{err, "Unable to save the settings."}
+		}
+		return setupSaved{api, model, key}
+	}
+}
+
+// saveSetup edits the lines of the settings file in place, like
+// saveDefaultAPI, to keep its comments.
+func saveSetup(path, api, model, key string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	quotedKey, err := yaml.Marshal(key)
+	if err != nil {
+		return err
+	}
+	quotedModel, err := yaml.Marshal(model)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(content), "\n")
+	start := -1
+	header := regexp.MustCompile(`^  ` + regexp.QuoteMeta(api) + `:\s*$`)
+	for i, line := range lines {
+		if header.MatchString(line) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return fmt.Errorf("the %s API isn't in %s", api, path)
+	}
+	keyLine := "    api-key: " + strings.TrimSpace(string(quotedKey))
+	existing := regexp.MustCompile(`^    (# )?api-key:`)
+	replaced := false
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "   ") {
+			break
+		}
+		if existing.MatchString(line) {
+			lines[i] = keyLine
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		lines = append(lines[:start+1], append([]string{keyLine}, lines[start+1:]...)...)
+	}
+	content = []byte(strings.Join(lines, "\n"))
+	modelLine := "default-model: " + strings.TrimSpace(string(quotedModel))
+	re := regexp.MustCompile(`(?m)^default-model:.*$`)
+	if re.Match(content) {
+		content = re.ReplaceAllLiteral(content, []byte(modelLine))
+	} else {
+		content = append([]byte(strings.TrimRight(string(content), "\n")), []byte("\n"+modelLine+"\n")...)
+	}
+	return os.WriteFile(path, content, 0o600) //nolint:gomnd
+}
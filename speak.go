@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// speakers are the text to speech commands tried in order when no speak
+// command is configured. They all read the text from their standard input.
+var speakers = [][]string{
+	{"say"},
+	{"spd-say", "--wait", "--pipe-mode"},
+	{"espeak", "--stdin"},
+	{"espeak-ng", "--stdin"},
+}
+
+// speak reads the text out loud with the speak command, or with the first of
+// the speakers that's installed. It does nothing if there's none.
+func speak(command, text string) error {
+	text = plainText(text)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var c *exec.Cmd
+	if command != "" {
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		c = exec.Command(shell, flag, command) //nolint:gosec
+	} else {
+		for _, s := range speakers {
+			if _, err := exec.LookPath(s[0]); err == nil {
+				c = exec.Command(s[0], s[1:]...) //nolint:gosec
+				break
+			}
+		}
+		if c == nil {
+			return nil
+		}
+	}
+	c.Stdin = strings.NewReader(text + "\n")
+	c.Stdout = io.Discard
+	return c.Run()
+}
+
+var markdownCleanups = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Code blocks don't read well, so they're left out.
+	{regexp.MustCompile("(?s)```.*?(```|$)"), ""},
+	{regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`(?m)^\s{0,3}(#{1,6}|>+|[-*+]|\d+[.)])\s+`), ""},
+	{regexp.MustCompile(`(?m)^\s*\|?(\s*:?-+:?\s*\|?)+\s*$`), ""},
+	{regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`), ""},
+	{regexp.MustCompile(`(?m)^[ \t]*\|[ \t]*|[ \t]*\|[ \t]*$`), ""},
+	{regexp.MustCompile(`[ \t]*\|[ \t]*`), ", "},
+	{regexp.MustCompile("[*_`~]+"), ""},
+	{regexp.MustCompile(`\n{3,}`), "\n\n"},
+}
+
+// plainText strips the Markdown formatting of the text, leaving the prose.
+func plainText(text string) string {
+	for _, c := range markdownCleanups {
+		text = c.re.ReplaceAllString(text, c.repl)
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// sseTransport is a http.RoundTripper that normalizes the server-sent events
+// streams of the responses, so servers that stray from how OpenAI sends them
+// can still be read.
+type sseTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct == "text/event-stream" {
+		resp.Body = &sseReader{body: resp.Body}
+	}
+	return resp, nil
+}
+
+// sseReader reads a server-sent events stream and rewrites each event as a
+// single "data: " line followed by a blank line. Lines are only parsed once
+// complete, whatever the size of the reads, and the CRLF line endings,
+// comments and fields other than data are handled as the spec says.
+type sseReader struct {
+	body io.ReadCloser
+	buf  []byte
+	line []byte
+	data [][]byte
+	// whole is whether the first data line of the event is a JSON document
+	// on its own.
+	whole bool
+	out   bytes.Buffer
+	err   error
+}
+
+func (r *sseReader) Read(p []byte) (int, error) {
+	if r.buf == nil {
+		r.buf = make([]byte, 4096) //nolint:gomnd
+	}
+	for r.out.Len() == 0 && r.err == nil {
+		n, err := r.body.Read(r.buf)
+		for _, b := range r.buf[:n] {
+			if b == '\n' {
+				r.parseLine(bytes.TrimSuffix(r.line, []byte("\r")))
+				r.line = r.line[:0]
+				continue
+			}
+			r.line = append(r.line, b)
+		}
+		if err != nil {
+			// The last event may not be followed by a blank line.
+			if len(r.line) > 0 {
+				r.parseLine(bytes.TrimSuffix(r.line, []byte("\r")))
+				r.line = nil
+			}
+			r.dispatch()
+			r.err = err
+		}
+	}
+	if r.out.Len() > 0 {
+		return r.out.Read(p)
+	}
+	return 0, r.err
+}
+
+func (r *sseReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *sseReader) parseLine(line []byte) {
+	if len(line) == 0 {
+		r.dispatch()
+		return
+	}
+	if line[0] == ':' {
+		// Comments are used by some servers to keep the connection alive.
+		return
+	}
+	field, value, _ := bytes.Cut(line, []byte(":"))
+	if string(field) != "data" {
+		return
+	}
+	value = bytes.TrimPrefix(value, []byte(" "))
+	// Some servers don't end their events with a blank line, so a data line
+	// after one holding a whole JSON document, or the end of the stream, ends
+	// the event too.
+	if r.whole {
+		r.dispatch()
+	}
+	if len(r.data) == 0 {
+		r.whole = json.Valid(value)
+	}
+	r.data = append(r.data, append([]byte(nil), value...))
+	if string(value) == "[DONE]" {
+		r.dispatch()
+	}
+}
+
+// dispatch writes the data of the current event, its lines joined with
+// spaces to fit on the single line the stream parser reads, which doesn't
+// change JSON documents.
+func (r *sseReader) dispatch() {
+	if len(r.data) == 0 {
+		return
+	}
+	r.out.WriteString("data: ")
+	r.out.Write(bytes.Join(r.data, []byte(" ")))
+	r.out.WriteString("\n\n")
+	r.data = r.data[:0]
+	r.whole = false
+}
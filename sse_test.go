@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "openai",
+			in:   "data: {\"a\":1}\n\ndata: [DONE]\n\n",
+			want: "data: {\"a\":1}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name: "crlf",
+			in:   "data: {\"a\":1}\r\n\r\ndata: [DONE]\r\n\r\n",
+			want: "data: {\"a\":1}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name: "comments",
+			in:   ": keep-alive\n\ndata: {\"a\":1}\n: keep-alive\n\n",
+			want: "data: {\"a\":1}\n\n",
+		},
+		{
+			name: "no space",
+			in:   "data:{\"a\":1}\n\n",
+			want: "data: {\"a\":1}\n\n",
+		},
+		{
+			name: "other fields",
+			in:   "event: message\nid: 1\nretry: 10\ndata: {\"a\":1}\n\n",
+			want: "data: {\"a\":1}\n\n",
+		},
+		{
+			name: "multi-line data",
+			in:   "data: {\"a\":\ndata: 1}\n\n",
+			want: "data: {\"a\": 1}\n\n",
+		},
+		{
+			name: "no blank lines",
+			in:   "data: {\"a\":1}\ndata: {\"b\":2}\ndata: [DONE]\n",
+			want: "data: {\"a\":1}\n\ndata: {\"b\":2}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name: "no final newline",
+			in:   "data: {\"a\":1}\n\ndata: {\"b\":2}",
+			want: "data: {\"a\":1}\n\ndata: {\"b\":2}\n\n",
+		},
+		{
+			name: "multi-byte characters",
+			in:   "data: {\"a\":\"héllo 世界\"}\n\n",
+			want: "data: {\"a\":\"héllo 世界\"}\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The stream split at every offset, as two reads.
+			for i := 0; i <= len(tt.in); i++ {
+				body := io.MultiReader(strings.NewReader(tt.in[:i]), strings.NewReader(tt.in[i:]))
+				got := readSSE(t, body)
+				if got != tt.want {
+					t.Errorf("split at %d: got %q, want %q", i, got, tt.want)
+				}
+			}
+			if got := readSSE(t, iotest.OneByteReader(strings.NewReader(tt.in))); got != tt.want {
+				t.Errorf("one byte at a time: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSEReaderError(t *testing.T) {
+	body := io.MultiReader(strings.NewReader("data: {\"a\":1}\n\ndata: {\"b\""), iotest.ErrReader(io.ErrUnexpectedEOF))
+	r := &sseReader{body: io.NopCloser(body)}
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	// What was read before the error is still passed on.
+	if want := "data: {\"a\":1}\n\ndata: {\"b\"\n\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func readSSE(t *testing.T, body io.Reader) string {
+	t.Helper()
+	out, err := io.ReadAll(&sseReader{body: io.NopCloser(body)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(out)
+}
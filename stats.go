@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tokenUsage is the number of tokens of the requests made for the response,
+// as reported by the API.
+type tokenUsage struct {
+	prompt     int
+	completion int
+}
+
+func (u tokenUsage) add(o tokenUsage) tokenUsage {
+	return tokenUsage{u.prompt + o.prompt, u.completion + o.completion}
+}
+
+// cost returns the price of the tokens with the prices of the model, per
+// million tokens, and whether they're known.
+func (u tokenUsage) cost(mod Model) (float64, bool) {
+	if mod.InputPrice == 0 && mod.OutputPrice == 0 {
+		return 0, false
+	}
+	const perTokens = 1_000_000
+	return (float64(u.prompt)*mod.InputPrice + float64(u.completion)*mod.OutputPrice) / perTokens, true
+}
+
+// reportsUsage returns whether the token usage of the responses is shown.
+func (c config) reportsUsage() bool {
+	return c.Stats || c.ShowUsage || c.Notify || c.Brainstorm > 0 || c.OutputFormat == "full-json"
+}
+
+// usageLine returns the summary of --show-usage: the tokens of the prompt and
+// the response, and their cost. When the API doesn't report them, they're
+// counted with the tokenizer, marked as estimated unless it's the one of the
+// model.
+func (m *Mods) usageLine() string {
+	mod := m.Config.Models[m.Config.Model]
+	if mod.Name == "" {
+		mod.Name = m.Config.Model
+	}
+	u, approx := m.usage, ""
+	if u.prompt == 0 && u.completion == 0 {
+		n, exact := countTokens(mod.Name, m.Output)
+		u = tokenUsage{m.promptTokens, n}
+		if !exact || !m.promptExact {
+			approx = "~"
+		}
+	}
+	line := fmt.Sprintf("usage: %s%s prompt + %s%s completion tokens", approx, groupDigits(u.prompt), approx, groupDigits(u.completion))
+	if c, ok := u.cost(mod); ok {
+		line += fmt.Sprintf(" · ~$%.4f", c)
+	}
+	return line
+}
+
+// formatStats returns the one line summary of the response shown with
+// --stats: the model, the time it took, its tokens and their cost.
+func formatStats(model string, mod Model, elapsed time.Duration, u tokenUsage) string {
+	parts := []string{model, elapsed.Round(time.Millisecond * 10).String()} //nolint:gomnd
+	if u.prompt > 0 || u.completion > 0 {
+		parts = append(parts, fmt.Sprintf("%d prompt + %d completion tokens", u.prompt, u.completion))
+		if c, ok := u.cost(mod); ok {
+			parts = append(parts, fmt.Sprintf("~$%.4f", c))
+		}
+	} else {
+		parts = append(parts, "tokens not reported")
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// stepsPrefix asks the model for the numbered steps parsed by --steps.
+const stepsPrefix = `Reply with the steps to follow as a numbered list, one step per item, like "1. Do this", without any introduction or conclusion.`
+
+var stepRe = regexp.MustCompile(`^\s*(\d+)[.)]\s+(.*)$`)
+
+// parseSteps returns the steps of the numbered list of the response. The lines
+// following a step, like its code, are part of it. It's an error if the
+// response has no steps or they aren't numbered from 1 in order.
+func parseSteps(text string) ([]string, error) {
+	var steps []string
+	inCode := false
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+		}
+		if m := stepRe.FindStringSubmatch(line); m != nil && !inCode {
+			if n, _ := strconv.Atoi(m[1]); n != len(steps)+1 {
+				return nil, fmt.Errorf("step %d follows step %d", n, len(steps))
+			}
+			steps = append(steps, m[2])
+			continue
+		}
+		if len(steps) == 0 {
+			if strings.TrimSpace(line) != "" {
+				return nil, errors.New("the response doesn't start with the first step")
+			}
+			continue
+		}
+		steps[len(steps)-1] += "\n" + line
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("the response has no steps")
+	}
+	for i, s := range steps {
+		steps[i] = strings.TrimSpace(s)
+	}
+	return steps, nil
+}
+
+// stepsJSON returns the steps of the response as a JSON array, for
+// --format=json.
+func stepsJSON(text string) (string, error) {
+	steps, err := parseSteps(text)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(steps, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
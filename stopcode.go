@@ -0,0 +1,49 @@
+package main
+
+import "strings"
+
+// firstCodeBlockEnd returns the index right after the closing fence of the
+// first complete code block of the response, or -1 while there's none. The
+// closing fence counts once its line is complete, as a longer one could be
+// on its way, and a fence of four backticks or tildes can hold blocks of
+// three. The reasoning before the answer is skipped.
+func firstCodeBlockEnd(s string) int {
+	_, answer := splitThinking(s)
+	offset := len(s) - len(answer)
+	fence := ""
+	pos := 0
+	for {
+		nl := strings.IndexByte(answer[pos:], '\n')
+		if nl < 0 {
+			return -1
+		}
+		line := strings.TrimRight(answer[pos:pos+nl], "\r")
+		end := pos + len(line)
+		pos += nl + 1
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 {
+			// Indented code, not a fence.
+			continue
+		}
+		marker := fenceMarker(trimmed)
+		switch {
+		case fence == "" && marker != "":
+			fence = marker
+		case fence != "" && len(marker) >= len(fence) && marker[0] == fence[0] && strings.TrimSpace(trimmed[len(marker):]) == "":
+			return offset + end
+		}
+	}
+}
+
+// fenceMarker returns the backticks or tildes starting the line if there
+// are enough to make a fence.
+func fenceMarker(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 { //nolint:gomnd
+		return ""
+	}
+	return line[:n]
+}
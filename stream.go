@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/mods/anim"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// completionStream is a response being streamed from an API.
+type completionStream interface {
+	// Recv returns the next chunk of content, or io.EOF once the response is
+	// complete.
+	Recv() (string, error)
+	Close()
+}
+
+// openaiStream adapts an OpenAI chat completion stream.
+type openaiStream struct {
+	*openai.ChatCompletionStream
+}
+
+func (s openaiStream) Recv() (string, error) {
+	resp, err := s.ChatCompletionStream.Recv()
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
+	return resp.Choices[0].Delta.Content, nil
+}
+
+// responseStream adapts a response that wasn't streamed, returning it whole
+// as a single chunk.
+type responseStream struct {
+	content string
+	done    bool
+	// choices are all the responses when several were asked for.
+	choices []string
+}
+
+func newResponseStream(resp openai.ChatCompletionResponse) *responseStream {
+	s := &responseStream{}
+	if len(resp.Choices) > 0 {
+		s.content = resp.Choices[0].Message.Content
+	}
+	if len(resp.Choices) > 1 {
+		for _, c := range resp.Choices {
+			s.choices = append(s.choices, c.Message.Content)
+		}
+	}
+	return s
+}
+
+func (s *responseStream) Recv() (string, error) {
+	if s.done {
+		return "", io.EOF
+	}
+	s.done = true
+	return s.content, nil
+}
+
+func (s *responseStream) Close() {}
+
+// completionStreamStart is a tea.Msg sent once the API starts streaming the
+// response.
+type completionStreamStart struct {
+	stream completionStream
+	prompt string
+	extras *responseExtras
+}
+
+// completionStreamChunk is a tea.Msg that wraps a chunk of the streamed
+// response.
+type completionStreamChunk struct{ content string }
+
+// completionStreamEnd is a tea.Msg sent once the response is complete, or
+// was stopped.
+type completionStreamEnd struct{}
+
+// completionStreamDrop is a tea.Msg sent when the stream fails after part of
+// the response was received, usually because the connection dropped.
+type completionStreamDrop struct{ err error }
+
+func (m *Mods) receiveCompletionStreamCmd() tea.Msg {
+	content, err := m.stream.Recv()
+	if errors.Is(err, io.EOF) || (err != nil && m.stopped) {
+		return completionStreamEnd{}
+	}
+	if err != nil && m.Output != "" {
+		return completionStreamDrop{err}
+	}
+	if err != nil {
+		return modsError{err, "There was an error while receiving the response."}
+	}
+	return completionStreamChunk{content}
+}
+
+// dropStream sends the request again after the connection dropped, with
+// --retry-on-drop. Otherwise, or once out of retries, the longest part of the
+// response received is kept, as a response cut short.
+func (m *Mods) dropStream(msg completionStreamDrop) (tea.Model, tea.Cmd) {
+	if len(m.Output) > len(m.dropped) {
+		m.dropped = m.Output
+	}
+	if m.Config.RetryOnDrop && m.canRetry() {
+		m.retries++
+		m.closeStream()
+		return m, m.startCompletionCmd(m.lastInput)
+	}
+	m.Output = m.dropped
+	m.dropped = ""
+	model, cmd := m.Update(completionStreamEnd{})
+	// Once the requests sent again failed too, there's no stream left to
+	// tell it was cut.
+	if m.warning == streamCutNotice || m.warning == "" {
+		m.warning = fmt.Sprintf("The connection dropped (%s), the response is incomplete.", msg.err)
+		if !m.Config.RetryOnDrop {
+			m.warning += " Use --retry-on-drop to send the request again."
+		}
+	}
+	return model, cmd
+}
+
+// startStream keeps track of the stream that just started and starts reading
+// from it.
+func (m *Mods) startStream(msg completionStreamStart) tea.Cmd {
+	m.stream = msg.stream
+	m.prompt = msg.prompt
+	m.choices = nil
+	if rs, ok := msg.stream.(*responseStream); ok {
+		m.choices = rs.choices
+		if !m.Config.AllowANSI {
+			for i, c := range m.choices {
+				m.choices[i] = escapeANSI(c)
+			}
+		}
+	}
+	m.extras = msg.extras
+	m.stopped = false
+	m.Output = ""
+	m.ansiHeld = ""
+	m.appended = 0
+	m.chunks = 0
+	m.updateProgress()
+	if m.Config.echo() && m.Config.progressive() == progressiveAppend && !m.echoed {
+		// The response is printed as it comes, the prompt goes first.
+		m.echoed = true
+		return tea.Sequence(tea.Println(formatUserTurn(m.styles, m.prompt)+"\n"), tea.Batch(m.receiveCompletionStreamCmd, m.startReveal()))
+	}
+	return tea.Batch(m.receiveCompletionStreamCmd, m.startReveal())
+}
+
+// updateProgress resolves the animation with the chunks streamed so far, about
+// a token each, out of --max-tokens. Without a maximum, the animation only
+// depends on the time.
+func (m *Mods) updateProgress() {
+	if m.Config.MaxTokens <= 0 || m.anim == nil {
+		return
+	}
+	m.anim, _ = m.anim.Update(anim.ProgressMsg(float64(m.chunks) / float64(m.Config.MaxTokens)))
+}
+
+// endStream closes the current stream and returns the completed response.
+func (m *Mods) endStream() completionOutput {
+	_, streamed := m.stream.(openaiStream)
+	m.closeStream()
+	m.dropped = ""
+	if m.ansiHeld != "" {
+		// The stream ended without the rest of the character.
+		m.Output += m.ansiHeld
+		if m.fifo != nil {
+			m.fifo.write(m.ansiHeld)
+		}
+		m.ansiHeld = ""
+	}
+	if m.fifo != nil {
+		m.fifo.write("\n")
+	}
+	thinking, content := splitThinking(m.Output)
+	m.Output = content
+	out := completionOutput{
+		prompt:    m.prompt,
+		content:   content,
+		reasoning: thinking,
+		empty:     !m.stopped && strings.TrimSpace(content) == "",
+	}
+	if m.extras != nil {
+		out.citations = m.extras.citations
+		out.logprobs = m.extras.logprobs
+		out.reasoning = strings.TrimSpace(m.extras.reasoning + "\n" + thinking)
+		out.usage = tokenUsage{m.extras.promptTokens, m.extras.completionTokens}
+		// A stream that ends without a finish reason was cut, by a proxy or
+		// a lost connection.
+		out.truncated = streamed && !m.stopped && m.extras.finishReason == ""
+		out.finishReason = m.extras.finishReason
+		out.refusal = strings.TrimSpace(m.extras.refusal)
+	}
+	m.request.event("done")
+	m.request.set("mods.finish_reason", out.finishReason)
+	m.request.set("mods.prompt_tokens", out.usage.prompt)
+	m.request.set("mods.completion_tokens", out.usage.completion)
+	m.request.finish(nil)
+	return out
+}
+
+func (m *Mods) closeStream() {
+	if m.stream != nil {
+		m.stream.Close()
+		m.stream = nil
+	}
+	if m.cancelRequest != nil {
+		m.cancelRequest()
+	}
+}
+
+// stopStream stops the generation, keeping what was received so far.
+func (m *Mods) stopStream() {
+	m.stopped = true
+	if m.cancelRequest != nil {
+		m.cancelRequest()
+	}
+}
+
+// isStopKey returns whether the key stops the generation.
+func isStopKey(msg tea.KeyMsg) bool {
+	return msg.Type == tea.KeyEsc || strings.EqualFold(msg.String(), "q")
+}
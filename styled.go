@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/quick"
+)
+
+var (
+	markdownHeading    = regexp.MustCompile(`(?m)^#{1,6}\s+.*$`)
+	markdownInlineCode = regexp.MustCompile("`[^`\n]+`")
+	markdownBold       = regexp.MustCompile(`\*\*[^*\n]+\*\*`)
+)
+
+// styleMarkdown styles the Markdown of the text for the terminal: headings
+// and bold text in bold, inline code like the rest of the inline code of
+// mods, and code blocks highlighted with the chroma code style if set.
+func styleMarkdown(s styles, text, codeStyle string) string {
+	var b strings.Builder
+	var code []string
+	lang := ""
+	inCode := false
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 && !inCode {
+			b.WriteString("\n")
+		}
+		if fence := strings.TrimSpace(line); strings.HasPrefix(fence, "```") {
+			if inCode {
+				b.WriteString(highlightCode(s, strings.Join(code, "\n"), lang, codeStyle))
+				b.WriteString("\n")
+				code = code[:0]
+			}
+			inCode = !inCode
+			lang = strings.TrimPrefix(fence, "```")
+			b.WriteString(s.comment.Render(line))
+			if inCode {
+				b.WriteString("\n")
+			}
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		if markdownHeading.MatchString(line) {
+			b.WriteString(s.appName.Render(line))
+			continue
+		}
+		line = markdownBold.ReplaceAllStringFunc(line, func(x string) string {
+			return s.appName.Render(strings.Trim(x, "*"))
+		})
+		line = markdownInlineCode.ReplaceAllStringFunc(line, func(x string) string {
+			return s.inlineCode.Render(strings.Trim(x, "`"))
+		})
+		b.WriteString(line)
+	}
+	if inCode {
+		// The code block was never closed.
+		b.WriteString("\n" + highlightCode(s, strings.Join(code, "\n"), lang, codeStyle))
+	}
+	return b.String()
+}
+
+// highlightCode highlights the code with chroma and the code style, or with
+// the cheap highlighting of the examples if there's no code style.
+func highlightCode(s styles, code, lang, codeStyle string) string {
+	if codeStyle == "" {
+		return cheapHighlighting(s, code)
+	}
+	if lang == "" {
+		lang = "plaintext"
+	}
+	var b strings.Builder
+	if err := quick.Highlight(&b, code, lang, "terminal256", codeStyle); err != nil {
+		return code
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
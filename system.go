@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const varEnvPrefix = "MODS_VAR_"
+
+const explainRole = `You explain shell commands to the user. Start with a
+one or two sentence summary of what the whole command does. Then list each
+flag and argument of the command on its own line, as "-f: what it does",
+keeping the explanations short. Mention anything dangerous the command could
+do. Don't suggest other commands unless the command has a mistake.`
+
+const fixRole = `The user gives you a shell command that failed, followed
+by its output if any. Reply with the corrected command in a single code block,
+followed by one sentence explaining what was wrong.`
+
+// plainTextInstruction is added to the system prompt by --no-markdown.
+const plainTextInstruction = `Reply in plain text, without any Markdown: no
+headings, emphasis, list markers, tables, links or code blocks.`
+
+const commitRole = `You write git commit messages following the
+Conventional Commits specification, from the git status and staged changes the
+user gives you. Start with a "type(scope): summary" subject line of at most 72
+characters, like "fix(parser): handle empty input", followed by a blank line
+and a short body explaining what changed and why if it isn't obvious. Reply
+with the commit message only, without code blocks or any other text.`
+
+// builtinRoles are the instructions of the roles mods ships with, by name.
+var builtinRoles = map[string]string{
+	"explain":  explainRole,
+	"fix":      fixRole,
+	"commit":   commitRole,
+	"diagnose": diagnoseRole,
+}
+
+// role returns the instructions of the role in use, if any.
+func (c config) role() string {
+	switch {
+	case c.Commit:
+		return commitRoleFor(c.CommitStyle, c.CommitSubjectLength)
+	case c.Explain:
+		return explainRole
+	case c.Fix:
+		return fixRole
+	case c.Diagnose:
+		return diagnoseRole
+	}
+	if r, ok := c.customRole(); ok {
+		return r.System
+	}
+	return builtinRoles[c.Role]
+}
+
+// modelRole returns the model-roles role of the model in use, looked up by
+// the name given and by the name of the model it's an alias of.
+func (c config) modelRole() string {
+	if role, ok := c.ModelRoles[c.Model]; ok {
+		return role
+	}
+	if mod, ok := c.Models[c.Model]; ok {
+		return c.ModelRoles[mod.Name]
+	}
+	return ""
+}
+
+// roleNames returns the names of the built-in roles and of the roles of the
+// settings, sorted.
+func (c config) roleNames() []string {
+	names := make([]string, 0, len(builtinRoles)+len(c.Roles))
+	for name := range builtinRoles {
+		names = append(names, name)
+	}
+	for name := range c.Roles {
+		if _, ok := builtinRoles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// systemPrompt renders the parts of the system prompt, in order: the system
+// prefix, the instructions of the role, --system, the plain text instruction
+// of --no-markdown, and the system suffix. With
+// --system-mode replace, --system takes the place of the role. The context
+// file comes last, see contextFileMiddleware. It returns an empty string when
+// there's nothing to send.
+func (c config) systemPrompt() (string, error) {
+	vars, err := c.templateVars()
+	if err != nil {
+		return "", err
+	}
+	role := c.role()
+	if c.SystemMode == "replace" && c.System != "" {
+		role = ""
+	}
+	plain := ""
+	if c.NoMarkdown {
+		plain = plainTextInstruction
+	}
+	var parts []string
+	for _, s := range []string{c.SystemPrefix, role, c.System, plain, c.SystemSuffix} {
+		s, err := expandTemplate(s, vars)
+		if err != nil {
+			return "", err
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// pinnedContext returns the content of the context file sent with every
+// request, unless --no-context is set.
+func (c config) pinnedContext() (string, error) {
+	if c.ContextFile == "" || c.NoContext {
+		return "", nil
+	}
+	path, err := expandHome(c.ContextFile)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// expandHome replaces the ~/ at the start of the path with the home
+// directory.
+func expandHome(path string) (string, error) {
+	rest := strings.TrimPrefix(path, "~/")
+	if rest == path {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, rest), nil
+}
+
+// templateVars returns the variables available to prompt templates: the
+// date and OS, then the MODS_VAR_* environment variables and the --var flags.
+// A variable named lang is used as {{.Lang}}.
+func (c config) templateVars() (map[string]string, error) {
+	vars := map[string]string{
+		"Date": time.Now().Format("January 2, 2006"),
+		"OS":   runtime.GOOS,
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if name := strings.TrimPrefix(k, varEnvPrefix); name != k && name != "" {
+			vars[varName(name)] = v
+		}
+	}
+	for _, kv := range c.Vars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected name=value", kv)
+		}
+		vars[varName(k)] = v
+	}
+	return vars, nil
+}
+
+// varName capitalizes the first letter of a variable name, lowercasing
+// environment style names first so LANG and lang both become Lang.
+func varName(s string) string {
+	if s == strings.ToUpper(s) {
+		s = strings.ToLower(s)
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// expandTemplate executes s as a template, failing on variables that weren't
+// provided.
+func expandTemplate(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var tableDelimiterRow = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// compactTables rewrites the Markdown tables of the text that are wider than
+// width as a list of "column: value" lines for each row.
+func compactTables(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		if i+1 >= len(lines) || !isTableRow(lines[i]) || !tableDelimiterRow.MatchString(lines[i+1]) {
+			out = append(out, lines[i])
+			continue
+		}
+		end := i + 2
+		for end < len(lines) && isTableRow(lines[end]) {
+			end++
+		}
+		table := lines[i:end]
+		if tableWidth(table) <= width {
+			out = append(out, table...)
+		} else {
+			out = append(out, tableAsList(table)...)
+		}
+		i = end - 1
+	}
+	return strings.Join(out, "\n")
+}
+
+func isTableRow(line string) bool {
+	return strings.Contains(line, "|") && strings.TrimSpace(line) != ""
+}
+
+func tableWidth(table []string) int {
+	w := 0
+	for _, line := range table {
+		if lw := lipgloss.Width(line); lw > w {
+			w = lw
+		}
+	}
+	return w
+}
+
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(c)
+	}
+	return cells
+}
+
+// tableAsList returns a "column: value" line for each cell, with rows
+// separated by a blank line.
+func tableAsList(table []string) []string {
+	header := tableCells(table[0])
+	var out []string
+	for i, row := range table[2:] {
+		if i > 0 {
+			out = append(out, "")
+		}
+		for j, cell := range tableCells(row) {
+			name := ""
+			if j < len(header) {
+				name = header[j]
+			}
+			if name == "" {
+				out = append(out, cell)
+				continue
+			}
+			out = append(out, name+": "+cell)
+		}
+	}
+	return out
+}
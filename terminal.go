@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/mattn/go-isatty"
+)
+
+// terminalInput reports whether keys can be read from the terminal when stdin
+// is piped, which is where Bubble Tea then reads them from: /dev/tty, or the
+// console on Windows. Keys typed to stop the response or to answer the setup
+// then don't get mixed up with the piped prompt.
+func terminalInput() bool {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint:errcheck
+	return isatty.IsTerminal(f.Fd())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/mods/anim"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// theme is the look of mods in one place: the ends of the gradient of the
+// animation and the help, the color of the cycling characters when there's no
+// gradient, the frames of the ellipsis and the code style of the styled
+// output. The gradient is blended with --gradient-blend.
+type theme struct {
+	Gradient struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"gradient"`
+	CyclingChars string   `json:"cycling_chars"`
+	Spinner      []string `json:"spinner"`
+	CodeStyle    string   `json:"code_style"`
+}
+
+// defaultTheme is the look of mods without a theme.
+func defaultTheme() theme {
+	var t theme
+	t.Gradient.Start = anim.DefaultGradient.Start
+	t.Gradient.End = anim.DefaultGradient.End
+	t.CyclingChars = "#FF87D7"
+	t.Spinner = anim.Ellipsis.Frames
+	return t
+}
+
+// builtinThemes are the themes mods ships with, by name. Their empty settings
+// are the ones of the default theme.
+var builtinThemes = map[string]theme{
+	"charm": defaultTheme(),
+	"mono": func() theme {
+		var t theme
+		t.Gradient.Start = "#EEEEEE"
+		t.Gradient.End = "#585858"
+		t.CyclingChars = "#A8A8A8"
+		t.CodeStyle = "bw"
+		return t
+	}(),
+	"ocean": func() theme {
+		var t theme
+		t.Gradient.Start = "#5FD7FF"
+		t.Gradient.End = "#005FAF"
+		t.CyclingChars = "#00AFD7"
+		t.Spinner = []string{"", "~", "~~", "~~~"}
+		t.CodeStyle = "nord"
+		return t
+	}(),
+}
+
+// themeNames returns the names of the built-in themes, sorted.
+func themeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadTheme returns the built-in theme with the name, or else the default
+// one, with the settings of the theme file, if any, on top.
+func loadTheme(name, path string) (theme, error) {
+	t := defaultTheme()
+	if name != "" {
+		builtin, ok := builtinThemes[name]
+		if !ok {
+			return t, fmt.Errorf("unknown theme %q, the themes are %s", name, strings.Join(themeNames(), ", "))
+		}
+		t = t.with(builtin)
+	}
+	if path == "" {
+		return t, nil
+	}
+	path, err := expandHome(path)
+	if err != nil {
+		return t, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return t, err
+	}
+	var file theme
+	if err := json.Unmarshal(b, &file); err != nil {
+		return t, fmt.Errorf("%s: %w", path, err)
+	}
+	t = t.with(file)
+	for _, c := range []string{t.Gradient.Start, t.Gradient.End, t.CyclingChars} {
+		if _, err := colorful.Hex(c); err != nil {
+			return t, fmt.Errorf("%s: invalid color %q, expected a hex color like #FF87D7", path, c)
+		}
+	}
+	return t, nil
+}
+
+// gradient returns the gradient of the theme, blended in the color space.
+func (t theme) gradient(blend string) anim.Gradient {
+	return anim.Gradient{Start: t.Gradient.Start, End: t.Gradient.End, Blend: blend}
+}
+
+// with returns the theme with the settings of o that are set.
+func (t theme) with(o theme) theme {
+	if o.Gradient.Start != "" {
+		t.Gradient.Start = o.Gradient.Start
+	}
+	if o.Gradient.End != "" {
+		t.Gradient.End = o.Gradient.End
+	}
+	if o.CyclingChars != "" {
+		t.CyclingChars = o.CyclingChars
+	}
+	if len(o.Spinner) > 0 {
+		t.Spinner = o.Spinner
+	}
+	if o.CodeStyle != "" {
+		t.CodeStyle = o.CodeStyle
+	}
+	return t
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// splitThinking separates the reasoning some models write between <think>
+// tags at the start of the response from the answer that follows. A
+// response that was stopped while thinking is all reasoning.
+func splitThinking(s string) (thinking, answer string) {
+	trimmed := strings.TrimLeft(s, " \t\r\n")
+	if !strings.HasPrefix(trimmed, thinkOpen) {
+		return "", s
+	}
+	trimmed = strings.TrimPrefix(trimmed, thinkOpen)
+	thinking, answer, found := strings.Cut(trimmed, thinkClose)
+	if !found {
+		return strings.TrimSpace(trimmed), ""
+	}
+	return strings.TrimSpace(thinking), strings.TrimLeft(answer, "\r\n")
+}
+
+// keepReasoning records the reasoning behind the last message, to save it
+// with the conversation.
+func (m *Mods) keepReasoning(reasoning string) {
+	if reasoning == "" {
+		return
+	}
+	if m.reasoning == nil {
+		m.reasoning = map[int]string{}
+	}
+	m.reasoning[len(m.messages)-1] = reasoning
+}
+
+// withReasoning returns a copy of the messages with their reasoning put back
+// between <think> tags, to send it along with --reasoning-context.
+func withReasoning(messages []openai.ChatCompletionMessage, reasoning map[int]string) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, len(messages))
+	copy(out, messages)
+	for i, r := range reasoning {
+		if i < len(out) {
+			out[i].Content = thinkOpen + "\n" + r + "\n" + thinkClose + "\n" + out[i].Content
+		}
+	}
+	return out
+}
+
+// reasoningNotice describes the reasoning that was left out of the output,
+// and how to show it.
+func reasoningNotice(reasoning string, saved *conversation) string {
+	how := "--think"
+	if saved != nil {
+		how = fmt.Sprintf("mods --replay %s --show-reasoning", saved.ID)
+	}
+	return fmt.Sprintf("▸ Thought for %d words, show the reasoning with %s", countWords(reasoning), how)
+}
+
+// formatThinking returns the reasoning of the model, dimmed, as shown with
+// --think.
+func formatThinking(s styles, thinking string) string {
+	var b strings.Builder
+	b.WriteString(s.comment.Render("# Thinking") + "\n\n")
+	for _, line := range strings.Split(strings.TrimSpace(thinking), "\n") {
+		b.WriteString(s.comment.Render("│ "+line) + "\n")
+	}
+	return b.String()
+}
+
+// compactHistoryMiddleware leaves the scaffolding of the earlier turns out of
+// the messages sent with --compact-history: the tool and function messages,
+// and the reasoning of the responses, keeping the final answers. The saved
+// conversation keeps everything.
+func compactHistoryMiddleware(cfg config) promptMiddleware {
+	return func(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+		last := lastUserMessage(messages)
+		if !cfg.CompactHistory || last < 0 {
+			return messages, nil
+		}
+		compacted := make([]openai.ChatCompletionMessage, 0, len(messages))
+		for i, msg := range messages {
+			if i >= last {
+				compacted = append(compacted, msg)
+				continue
+			}
+			switch msg.Role {
+			case openai.ChatMessageRoleSystem, openai.ChatMessageRoleUser:
+			case openai.ChatMessageRoleAssistant:
+				_, msg.Content = splitThinking(msg.Content)
+				if strings.TrimSpace(msg.Content) == "" {
+					// Only reasoning, or a call to a tool.
+					continue
+				}
+			default:
+				continue
+			}
+			compacted = append(compacted, msg)
+		}
+		return compacted, nil
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultTitlePrompt = "Write a short title for a conversation starting with the message below. " +
+		"Reply with the title only, without quotes or punctuation at the end."
+	maxTitleChars       = 80
+	maxTitleSourceChars = 2000
+)
+
+// conversationTitle returns the title of the conversation: one generated by
+// the model if auto-title is on, or else its first message, shortened.
+func (m *Mods) conversationTitle() string {
+	first := ""
+	for _, msg := range m.messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			first = msg.Content
+			break
+		}
+	}
+	if strings.TrimSpace(first) == "" {
+		return ""
+	}
+	if m.Config.AutoTitle {
+		if title := m.generateTitle(first); title != "" {
+			return title
+		}
+	}
+	return cleanTitle(strings.Join(strings.Fields(first), " "))
+}
+
+// generateTitle asks the title model, or the model in use, for a title
+// summarizing the conversation from its first message. It returns an empty
+// string if that fails.
+func (m *Mods) generateTitle(first string) string {
+	if r := []rune(first); len(r) > maxTitleSourceChars {
+		first = string(r[:maxTitleSourceChars])
+	}
+
+	// The title is asked on its own, with none of the options of the prompt.
+	mc := *m
+	mc.Config.Prefix = ""
+	mc.Config.Markdown = false
+	mc.Config.Logprobs = false
+	mc.Config.Depth = 0
+	if mc.Config.TitleModel != "" {
+		mc.Config.Model = mc.Config.TitleModel
+	}
+	mc.messages = nil
+	mc.steps = nil
+	mc.cancelRequest = nil
+	mc.retries = 0
+	res := mc.completeWith("title", m.Config.TitlePrompt+"\n\n"+first)
+	if res.err != nil {
+		return ""
+	}
+	return cleanTitle(res.content)
+}
+
+// cleanTitle keeps the first line of the response, without the quotes or
+// Markdown the model may have added.
+func cleanTitle(s string) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	s = strings.TrimPrefix(strings.TrimSpace(s), "Title:")
+	s = strings.Trim(s, "\"'`*#. \t")
+	if r := []rune(s); len(r) > maxTitleChars {
+		s = strings.TrimSpace(string(r[:maxTitleChars-1])) + "…"
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// approxEncoding is the encoding the models that aren't OpenAI's are counted
+// with. Their tokenizers differ, but not by much for limits and estimates.
+const approxEncoding = tiktoken.MODEL_CL100K_BASE
+
+// o200kPrefixes are the models using o200k_base that tiktoken-go doesn't know
+// yet.
+var o200kPrefixes = []string{"gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"}
+
+// encoders are the encodings loaded so far, by name. Loading the BPE ranks
+// takes a while, so it's only done once a count is needed, and once per
+// encoding.
+var (
+	encodersMu sync.Mutex
+	encoders   = map[string]*tiktoken.Tiktoken{}
+	bpeLoader  sync.Once
+)
+
+// encodingName returns the name of the encoding of the model, and whether
+// it's the one the model uses rather than an approximation.
+func encodingName(model string) (string, bool) {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name, true
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name, true
+		}
+	}
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_O200K_BASE, true
+		}
+	}
+	return approxEncoding, false
+}
+
+// tokenizer returns the encoding of the model, and whether it's exact. The
+// BPE ranks are embedded, so it works offline.
+func tokenizer(model string) (*tiktoken.Tiktoken, bool, error) {
+	bpeLoader.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+	name, exact := encodingName(model)
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	if enc, ok := encoders[name]; ok {
+		return enc, exact, nil
+	}
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, false, err
+	}
+	encoders[name] = enc
+	return enc, exact, nil
+}
+
+// countTokens returns the number of tokens of s for the model, and whether
+// the count is exact. Without a tokenizer, it's estimated from the number of
+// characters.
+func countTokens(model, s string) (int, bool) {
+	if s == "" {
+		return 0, true
+	}
+	enc, exact, err := tokenizer(model)
+	if err != nil {
+		return (utf8.RuneCountInString(s) + charsPerToken - 1) / charsPerToken, false
+	}
+	return len(enc.EncodeOrdinary(s)), exact
+}
+
+// countMessageTokens returns the number of tokens of the content of the
+// messages, and whether the count is exact.
+func countMessageTokens(model string, messages []openai.ChatCompletionMessage) (int, bool) {
+	total, exact := 0, true
+	for _, msg := range messages {
+		n, ok := countTokens(model, msg.Content)
+		total += n
+		exact = exact && ok
+	}
+	return total, exact
+}
+
+// truncateTokens cuts the input to limit tokens of the model, keeping its
+// beginning, its end, or both ends around a note of what was cut out, like
+// truncateInput does with bytes.
+func truncateTokens(model, s string, limit int, strategy string) string {
+	if len(s) <= limit {
+		// A token is at least a byte.
+		return s
+	}
+	enc, _, err := tokenizer(model)
+	if err != nil {
+		return truncateInput(s, limit*charsPerToken, strategy)
+	}
+	tokens := enc.EncodeOrdinary(s)
+	if len(tokens) <= limit {
+		return s
+	}
+	// The tokens at the cuts can hold part of a character, which is dropped.
+	decode := func(tokens []int) string {
+		return strings.ToValidUTF8(enc.Decode(tokens), "")
+	}
+	switch strategy {
+	case truncateTail:
+		return decode(tokens[len(tokens)-limit:])
+	case truncateMiddle:
+		note := tokenCutNote(len(tokens) - limit)
+		keep := limit - len(enc.EncodeOrdinary(note))
+		if keep <= 0 {
+			break
+		}
+		head := keep / 2 //nolint:gomnd
+		tail := len(tokens) - (keep - head)
+		return decode(tokens[:head]) + tokenCutNote(tail-head) + decode(tokens[tail:])
+	}
+	return decode(tokens[:limit])
+}
+
+func tokenCutNote(n int) string {
+	return fmt.Sprintf("\n\n[... %d tokens cut ...]\n\n", n)
+}
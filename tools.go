@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
+
+	tea "github.com/charmbracelet/bubbletea"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxToolRounds is how many times in a row the model can call the tools
+	// before giving an answer, not to loop forever.
+	maxToolRounds = 10
+
+	// maxToolOutput is the most of the output of a command sent back to the
+	// model.
+	maxToolOutput = 16000
+)
+
+var toolNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tool is a function the model can call with --tools, which runs a shell
+// command. The arguments of the call, described by the JSON schema of the
+// parameters, fill the command template as {{.name}}, quoted for the shell.
+type Tool struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Parameters  map[string]any `yaml:"parameters"`
+	Command     string         `yaml:"command"`
+}
+
+// validate reports what's wrong with the tool of the settings.
+func (t Tool) validate() error {
+	if !toolNameRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid tool name %q, expected letters, digits, underscores and dashes", t.Name)
+	}
+	if strings.TrimSpace(t.Command) == "" {
+		return fmt.Errorf("the tool %s has no command", t.Name)
+	}
+	if _, err := template.New(t.Name).Parse(t.Command); err != nil {
+		return fmt.Errorf("the command of the tool %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// definition returns the tool as sent in the tools of the request.
+func (t Tool) definition() map[string]any {
+	params := t.Parameters
+	if params == nil {
+		params = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  params,
+		},
+	}
+}
+
+// command returns the command to run for the arguments of the call, a JSON
+// object.
+func (t Tool) command(arguments string) (string, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("the arguments aren't a JSON object: %w", err)
+		}
+	}
+	quoted := make(map[string]string, len(args))
+	for k, v := range args {
+		s, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+		quoted[k] = shellQuote(s)
+	}
+	tmpl, err := template.New(t.Name).Option("missingkey=zero").Parse(t.Command)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, quoted); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// tool returns the tool of the settings with the given name.
+func (c config) tool(name string) (Tool, bool) {
+	for _, t := range c.Tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+// toolDefinitions returns the tools sent with the requests.
+func (c config) toolDefinitions() []map[string]any {
+	defs := make([]map[string]any, 0, len(c.Tools))
+	for _, t := range c.Tools {
+		defs = append(defs, t.definition())
+	}
+	return defs
+}
+
+// toolCall is a call of one of the tools by the model.
+type toolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// toolCallDelta is a part of a tool call, as streamed.
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// addToolCalls adds the parts of the tool calls streamed to the calls they
+// belong to, by index.
+func (e *responseExtras) addToolCalls(deltas []toolCallDelta) {
+	for _, d := range deltas {
+		for len(e.toolCalls) <= d.Index {
+			e.toolCalls = append(e.toolCalls, toolCall{})
+		}
+		c := &e.toolCalls[d.Index]
+		if d.ID != "" {
+			c.ID = d.ID
+		}
+		c.Name += d.Function.Name
+		c.Arguments += d.Function.Arguments
+	}
+}
+
+// toolRun is the state of the tool calls of a response, run one after the
+// other once confirmed.
+type toolRun struct {
+	content string
+	calls   []toolCall
+	results []string
+	command string
+}
+
+// toolOutput is a tea.Msg that wraps the output of the command of a call.
+type toolOutput struct{ output string }
+
+// startToolCalls handles the tool calls that ended the response, asking to
+// run their commands. The response is then asked for again with their
+// output.
+func (m *Mods) startToolCalls(out completionOutput, calls []toolCall) tea.Cmd {
+	if m.toolRounds >= maxToolRounds {
+		return func() tea.Msg {
+			return modsError{
+				reason: "The model keeps calling the tools.",
+				err:    fmt.Errorf("It called them %d times in a row without answering.", maxToolRounds),
+			}
+		}
+	}
+	if !m.terminal && !m.Config.Yolo {
+		return func() tea.Msg {
+			return modsError{
+				reason: "The model wants to run a tool.",
+				err:    fmt.Errorf("Run %s from a terminal, to confirm its commands.", m.styles.inlineCode.Render("mods --tools")),
+			}
+		}
+	}
+	m.toolRounds++
+	m.tools = &toolRun{content: out.content, calls: calls}
+	return m.nextToolCall()
+}
+
+// nextToolCall asks to run the command of the next call, or sends the
+// results once they're all done.
+func (m *Mods) nextToolCall() tea.Cmd {
+	r := m.tools
+	for len(r.results) < len(r.calls) {
+		call := r.calls[len(r.results)]
+		tool, ok := m.Config.tool(call.Name)
+		if !ok {
+			r.results = append(r.results, fmt.Sprintf("There's no tool named %q.", call.Name))
+			continue
+		}
+		command, err := tool.command(call.Arguments)
+		if err != nil {
+			r.results = append(r.results, "The command couldn't be made: "+err.Error())
+			continue
+		}
+		r.command = command
+		if m.toolsAllowed {
+			return m.runToolCall()
+		}
+		m.state = toolConfirmState
+		return nil
+	}
+	m.toolTurns = append(m.toolTurns, toolTurns(r)...)
+	m.tools = nil
+	m.state = completionState
+	return m.startCompletionCmd(m.lastInput)
+}
+
+// runToolCall runs the command of the current call, in the sandbox of the
+// settings if there's one.
+func (m *Mods) runToolCall() tea.Cmd {
+	m.state = completionState
+	command := m.tools.command
+	run, err := m.Config.sandboxed(command)
+	if err != nil {
+		return func() tea.Msg {
+			return modsError{withExitCode(err, exitConfig), "There was an error in your tool sandbox."}
+		}
+	}
+	return tea.Sequence(
+		tea.Println(m.styles.comment.Render("$ "+escapeANSI(command))),
+		func() tea.Msg { return toolOutput{runTool(run)} },
+	)
+}
+
+// sandboxed returns the command wrapped in the tool-sandbox of the settings,
+// or as is without one.
+func (c config) sandboxed(command string) (string, error) {
+	if c.ToolSandbox == "" {
+		return command, nil
+	}
+	tmpl, err := template.New("tool-sandbox").Option("missingkey=error").Parse(c.ToolSandbox)
+	if err != nil {
+		return "", fmt.Errorf("tool-sandbox: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]string{"Command": shellQuote(command)}); err != nil {
+		return "", fmt.Errorf("tool-sandbox: %w", err)
+	}
+	if !strings.Contains(b.String(), shellQuote(command)) {
+		return "", errors.New("tool-sandbox doesn't use {{.Command}}")
+	}
+	return b.String(), nil
+}
+
+// yoloWarning is printed at the start with --yolo, which runs the commands
+// without confirming them.
+func (m *Mods) yoloWarning() string {
+	return m.styles.errorHeader.Copy().SetString("WARNING").String() + " " +
+		m.styles.flag.Render("--yolo runs every command the model asks for without asking you first.")
+}
+
+// updateToolConfirm handles the keys pressed while asked to run a command.
+// Not running it is the default, and always runs the next ones without
+// asking, until mods exits.
+func (m *Mods) updateToolConfirm(msg tea.KeyMsg) tea.Cmd {
+	r := m.tools
+	switch msg.String() {
+	case "ctrl+c", "esc", "q":
+		m.aborted = true
+		return tea.Quit
+	case "y":
+		return m.runToolCall()
+	case "a":
+		m.toolsAllowed = true
+		return m.runToolCall()
+	case "n", "N", "enter":
+		r.results = append(r.results, "The user declined to run the command.")
+		return tea.Sequence(
+			tea.Println(m.styles.comment.Render("Skipped: "+escapeANSI(r.command))),
+			m.nextToolCall(),
+		)
+	}
+	return nil
+}
+
+// toolConfirmView asks whether to run the command.
+func (m *Mods) toolConfirmView() string {
+	call := m.tools.calls[len(m.tools.results)]
+	return fmt.Sprintf(
+		"\nThe model wants to run %s:\n\n  %s\n\n%s\n",
+		m.styles.inlineCode.Render(call.Name),
+		m.styles.flag.Render("$ "+escapeANSI(m.tools.command)),
+		m.styles.comment.Render("y to run it, a to always run them, N to skip it, esc to quit"),
+	)
+}
+
+// runTool runs the command and returns its output, as sent to the model.
+func runTool(command string) string {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	out, err := exec.Command(shell, flag, command).CombinedOutput() //nolint:gosec
+	s := string(out)
+	if len(s) > maxToolOutput {
+		s = s[:runeEnd(s, maxToolOutput)] + "\n(the output was cut)"
+	}
+	if err != nil {
+		s = strings.TrimRight(s, "\n") + "\n(" + err.Error() + ")"
+	}
+	if strings.TrimSpace(s) == "" {
+		s = "(no output)"
+	}
+	return s
+}
+
+// toolTurns returns the messages of the tool calls and their results, sent
+// after the prompt.
+func toolTurns(r *toolRun) []map[string]any {
+	calls := make([]map[string]any, 0, len(r.calls))
+	for _, c := range r.calls {
+		calls = append(calls, map[string]any{
+			"id":   c.ID,
+			"type": "function",
+			"function": map[string]any{
+				"name":      c.Name,
+				"arguments": c.Arguments,
+			},
+		})
+	}
+	turns := []map[string]any{{"role": openai.ChatMessageRoleAssistant, "content": r.content, "tool_calls": calls}}
+	for i, c := range r.calls {
+		turns = append(turns, map[string]any{"role": "tool", "tool_call_id": c.ID, "content": r.results[i]})
+	}
+	return turns
+}
+
+// withToolTurns returns the messages of the request followed by the tool
+// calls made so far, which the OpenAI messages can't hold.
+func withToolTurns(messages []openai.ChatCompletionMessage, turns []map[string]any) []map[string]any {
+	all := make([]map[string]any, 0, len(messages)+len(turns))
+	for _, msg := range messages {
+		m := map[string]any{"role": msg.Role, "content": msg.Content}
+		if msg.Name != "" {
+			m["name"] = msg.Name
+		}
+		all = append(all, m)
+	}
+	return append(all, turns...)
+}
+
+// shellQuote quotes the argument for the shell the commands run in.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTraceEndpoint is where the spans are sent without the OTEL_*
+// variables, the OTLP/HTTP port of a local collector.
+const defaultTraceEndpoint = "http://localhost:4318/v1/traces"
+
+// defaultTraceTimeout is how long the export waits for the collector, as
+// OTEL_EXPORTER_OTLP_TIMEOUT does by default.
+const defaultTraceTimeout = 10 * time.Second
+
+// tracer records the spans of a run, exported at the end to an OpenTelemetry
+// collector with --trace. It's safe to use from the commands, which run
+// concurrently, and a nil tracer records nothing.
+type tracer struct {
+	mu      sync.Mutex
+	traceID string
+	parent  string
+	root    *span
+	spans   []*span
+}
+
+// span is an operation of the run, like the HTTP request to the API.
+type span struct {
+	t      *tracer
+	id     string
+	parent string
+	name   string
+	start  time.Time
+	end    time.Time
+	attrs  map[string]any
+	events []spanEvent
+	err    string
+}
+
+type spanEvent struct {
+	name  string
+	time  time.Time
+	attrs map[string]any
+}
+
+// newTracer starts the trace of the run, continuing the one of the TRACEPARENT
+// variable set by the pipeline running mods, if any.
+func newTracer() *tracer {
+	t := &tracer{traceID: randomHex(16)} //nolint:gomnd
+	// version-traceid-parentid-flags, see https://www.w3.org/TR/trace-context/.
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 { //nolint:gomnd
+		t.traceID, t.parent = parts[1], parts[2]
+	}
+	t.root = t.startSpan("mods", nil)
+	return t
+}
+
+// startSpan starts a span, a child of parent or else of the root span.
+func (t *tracer) startSpan(name string, parent *span) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{t: t, id: randomHex(8), name: name, start: time.Now(), attrs: map[string]any{}} //nolint:gomnd
+	switch {
+	case parent != nil:
+		s.parent = parent.id
+	case t.root != nil:
+		s.parent = t.root.id
+	default:
+		s.parent = t.parent
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	s.attrs[key] = value
+	s.t.mu.Unlock()
+}
+
+// event records something that happened during the span, with the time since
+// it started.
+func (s *span) event(name string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.t.mu.Lock()
+	s.events = append(s.events, spanEvent{name, now, map[string]any{
+		"mods.elapsed_ms": now.Sub(s.start).Milliseconds(),
+	}})
+	s.t.mu.Unlock()
+}
+
+// finish ends the span, failed with the error if there's one. Only the first
+// call counts.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+}
+
+// tracing returns whether the spans are exported: with --trace, or when an
+// OTLP endpoint is set in the environment, unless OTEL_SDK_DISABLED or
+// OTEL_TRACES_EXPORTER=none say otherwise.
+func (c config) tracing() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return c.Trace || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// traceEndpoint returns the URL the spans are sent to, from the standard
+// variables.
+func traceEndpoint() string {
+	if ep := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); ep != "" {
+		return ep
+	}
+	if ep := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); ep != "" {
+		return strings.TrimRight(ep, "/") + "/v1/traces"
+	}
+	return defaultTraceEndpoint
+}
+
+// export ends the root span and sends the spans to the collector, with
+// OTLP/HTTP in JSON.
+func (t *tracer) export(err error) error {
+	if t == nil {
+		return nil
+	}
+	t.root.finish(err)
+	body, merr := json.Marshal(t.payload())
+	if merr != nil {
+		return merr
+	}
+	timeout := defaultTraceTimeout
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_EXPORTER_OTLP_TIMEOUT")); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, rerr := http.NewRequestWithContext(ctx, http.MethodPost, traceEndpoint(), bytes.NewReader(body))
+	if rerr != nil {
+		return rerr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range otelList(firstEnv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS")) {
+		req.Header.Set(k, v)
+	}
+	resp, herr := http.DefaultClient.Do(req)
+	if herr != nil {
+		return herr
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", traceEndpoint(), resp.Status)
+	}
+	return nil
+}
+
+// exportTrace exports the spans of the run when tracing, telling about the
+// failures with --verbose only, not to get in the way of the response.
+func (m *Mods) exportTrace(err error) {
+	if !m.Config.tracing() {
+		return
+	}
+	if err := m.trace.export(err); err != nil && m.Config.Verbose {
+		fmt.Fprintln(os.Stderr, m.styles.comment.Render("Unable to export the trace: "+err.Error()))
+	}
+}
+
+// payload returns the spans in the JSON encoding of an OTLP export request.
+func (t *tracer) payload() map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	resource := map[string]any{"service.name": "mods", "service.version": version}
+	for k, v := range otelList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES")) {
+		resource[k] = v
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+	spans := make([]map[string]any, 0, len(t.spans))
+	for _, s := range t.spans {
+		end := s.end
+		if end.IsZero() {
+			// Like the request of a run that was interrupted.
+			end = t.root.end
+		}
+		js := map[string]any{
+			"traceId":           t.traceID,
+			"spanId":            s.id,
+			"name":              s.name,
+			"kind":              1, // internal
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+		}
+		if s.parent != "" {
+			js["parentSpanId"] = s.parent
+		}
+		if s.err != "" {
+			js["status"] = map[string]any{"code": 2, "message": s.err} //nolint:gomnd
+		}
+		events := make([]map[string]any, 0, len(s.events))
+		for _, e := range s.events {
+			events = append(events, map[string]any{
+				"name":         e.name,
+				"timeUnixNano": strconv.FormatInt(e.time.UnixNano(), 10),
+				"attributes":   otlpAttributes(e.attrs),
+			})
+		}
+		js["events"] = events
+		spans = append(spans, js)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(resource)},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/charmbracelet/mods"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes returns the attributes as OTLP key values.
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	kvs := make([]map[string]any, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, map[string]any{"key": k, "value": value})
+	}
+	return kvs
+}
+
+// otelList parses the key=value,key=value lists of the OTEL_* variables,
+// whose values are URL encoded.
+func otelList(s string) map[string]string {
+	kvs := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if uv, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = uv
+		}
+		kvs[strings.TrimSpace(k)] = v
+	}
+	return kvs
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
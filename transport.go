@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// paramsTransport is a http.RoundTripper that adds extra top level fields to
+// JSON request bodies. It's used to send provider specific parameters that
+// aren't part of the OpenAI request struct.
+type paramsTransport struct {
+	params map[string]any
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t paramsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || len(t.params) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range t.params {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = raw
+	}
+	body, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return t.base.RoundTrip(req)
+}
+
+// userAgentTransport is a http.RoundTripper that sets the User-Agent header
+// of the requests.
+type userAgentTransport struct {
+	agent string
+	base  http.RoundTripper
+}
+
+// userAgent returns the configured User-Agent, or one naming the version of
+// mods.
+func (c config) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return "mods/" + version
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.agent)
+	return t.base.RoundTrip(req)
+}
+
+// responseExtras holds the fields some providers return alongside the
+// completion that aren't part of the OpenAI response structs.
+type responseExtras struct {
+	// citations are the sources of the response, returned by Perplexity or
+	// by the web search of --web.
+	citations []string
+	// logprobs are the tokens of the response and their log probabilities,
+	// when requested with --logprobs.
+	logprobs []tokenLogprob
+	// reasoning is the thinking of reasoning models, returned apart from the
+	// content by DeepSeek, OpenRouter, vLLM and others.
+	reasoning string
+	// completionTokens and promptTokens are the number of tokens of the
+	// response and of the prompt, when the API reports its usage.
+	completionTokens int
+	promptTokens     int
+	// finishReason is why the model stopped, missing if the response was
+	// cut short.
+	finishReason string
+	// refusal is the explanation of the model when it declines to answer,
+	// sent by OpenAI apart from the content.
+	refusal string
+	// toolCalls are the calls of the tools of --tools the response ended
+	// with.
+	toolCalls []toolCall
+}
+
+// addCitation adds the source to the citations, unless it's already there.
+func (e *responseExtras) addCitation(url string) {
+	for _, c := range e.citations {
+		if c == url {
+			return
+		}
+	}
+	e.citations = append(e.citations, url)
+}
+
+// tokenLogprob is a token of the response with its log probability, and the
+// most likely tokens that could have been in its place.
+type tokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	Probability float64        `json:"probability,omitempty"`
+	TopLogprobs []tokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// extrasTransport is a http.RoundTripper that captures the responseExtras of
+// the responses.
+type extrasTransport struct {
+	extras *responseExtras
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t extrasTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	resp.Body = &extrasReader{ReadCloser: resp.Body, extras: t.extras}
+	return resp, nil
+}
+
+// extrasReader looks for the extra fields in each JSON document or
+// server-sent event read from the wrapped body.
+type extrasReader struct {
+	io.ReadCloser
+	extras *responseExtras
+	line   []byte
+}
+
+func (r *extrasReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	for _, b := range p[:n] {
+		if b == '\n' {
+			r.parse()
+			continue
+		}
+		r.line = append(r.line, b)
+	}
+	if err == io.EOF {
+		r.parse()
+	}
+	return n, err
+}
+
+func (r *extrasReader) Close() error {
+	r.parse()
+	return r.ReadCloser.Close()
+}
+
+func (r *extrasReader) parse() {
+	line := bytes.TrimPrefix(bytes.TrimSpace(r.line), []byte("data:"))
+	r.line = r.line[:0]
+	if len(line) == 0 {
+		return
+	}
+	var v struct {
+		Citations []string `json:"citations"`
+		Usage     *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+		Choices []struct {
+			Logprobs *struct {
+				Content []tokenLogprob `json:"content"`
+			} `json:"logprobs"`
+			Delta        messageExtras `json:"delta"`
+			Message      messageExtras `json:"message"`
+			FinishReason string        `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(line, &v); err != nil {
+		return
+	}
+	if len(v.Citations) > 0 {
+		r.extras.citations = v.Citations
+	}
+	if v.Usage != nil && v.Usage.CompletionTokens > 0 {
+		r.extras.completionTokens = v.Usage.CompletionTokens
+		r.extras.promptTokens = v.Usage.PromptTokens
+	}
+	for _, c := range v.Choices {
+		if c.FinishReason != "" {
+			r.extras.finishReason = c.FinishReason
+		}
+		for _, a := range append(c.Delta.Annotations, c.Message.Annotations...) {
+			if a.Type == "url_citation" && a.URLCitation.URL != "" {
+				r.extras.addCitation(a.URLCitation.URL)
+			}
+		}
+	}
+	if len(v.Choices) > 0 && v.Choices[0].Logprobs != nil {
+		r.extras.logprobs = append(r.extras.logprobs, v.Choices[0].Logprobs.Content...)
+	}
+	if len(v.Choices) > 0 {
+		r.extras.reasoning += v.Choices[0].Delta.text() + v.Choices[0].Message.text()
+		r.extras.refusal += v.Choices[0].Delta.Refusal + v.Choices[0].Message.Refusal
+		r.extras.addToolCalls(v.Choices[0].Delta.ToolCalls)
+		for _, c := range v.Choices[0].Message.ToolCalls {
+			// Whole, without an index.
+			r.extras.toolCalls = append(r.extras.toolCalls, toolCall{c.ID, c.Function.Name, c.Function.Arguments})
+		}
+	}
+}
+
+// messageExtras are the fields of a message or delta that aren't part of the
+// OpenAI structs: the reasoning, the refusal, the tool calls, and the sources
+// found by the web search.
+type messageExtras struct {
+	ReasoningContent string          `json:"reasoning_content"`
+	Reasoning        string          `json:"reasoning"`
+	Refusal          string          `json:"refusal"`
+	ToolCalls        []toolCallDelta `json:"tool_calls"`
+	Annotations      []struct {
+		Type        string `json:"type"`
+		URLCitation struct {
+			URL string `json:"url"`
+		} `json:"url_citation"`
+	} `json:"annotations"`
+}
+
+// text returns the reasoning.
+func (f messageExtras) text() string {
+	if f.ReasoningContent != "" {
+		return f.ReasoningContent
+	}
+	return f.Reasoning
+}
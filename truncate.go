@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// The parts of the input kept by --truncate.
+const (
+	truncateHead   = "head"
+	truncateTail   = "tail"
+	truncateMiddle = "middle"
+)
+
+// truncateInput cuts the input to limit bytes, keeping its beginning, its
+// end, or both ends around a note of what was cut out. It never cuts a
+// character in two.
+func truncateInput(s string, limit int, strategy string) string {
+	if len(s) <= limit {
+		return s
+	}
+	switch strategy {
+	case truncateTail:
+		return s[runeStart(s, len(s)-limit):]
+	case truncateMiddle:
+		keep := limit - len(cutNote(len(s)))
+		if keep <= 0 {
+			break
+		}
+		head := runeEnd(s, keep/2) //nolint:gomnd
+		tail := runeStart(s, len(s)-(keep-head))
+		return s[:head] + cutNote(tail-head) + s[tail:]
+	}
+	return s[:runeEnd(s, limit)]
+}
+
+func cutNote(n int) string {
+	return fmt.Sprintf("\n\n[... %d characters cut ...]\n\n", n)
+}
+
+// runeEnd returns the largest index up to i that doesn't split a character.
+func runeEnd(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// runeStart returns the smallest index from i that doesn't split a
+// character.
+func runeStart(s string, i int) int {
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
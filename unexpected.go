@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// unexpectedResponseStart is how much of an unexpected response is shown.
+const unexpectedResponseStart = 120
+
+// unexpectedResponseError is a successful response that isn't JSON nor
+// server-sent events, like the HTML page of a corporate proxy or of a login
+// portal.
+type unexpectedResponseError struct {
+	status      string
+	contentType string
+	start       string
+}
+
+func (e unexpectedResponseError) Error() string {
+	return fmt.Sprintf("unexpected response (likely a proxy or auth page): %s, %s, starting with %q", e.status, e.contentType, e.start)
+}
+
+// checkResponseTransport is a http.RoundTripper that fails the successful
+// responses that can't come from the API, instead of failing to parse them
+// further down.
+type checkResponseTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t checkResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !unexpectedContentType(ct) {
+		return resp, nil
+	}
+	start, _ := io.ReadAll(io.LimitReader(resp.Body, unexpectedResponseStart))
+	_ = resp.Body.Close()
+	return nil, unexpectedResponseError{
+		status:      resp.Status,
+		contentType: resp.Header.Get("Content-Type"),
+		start:       strings.Join(strings.Fields(string(start)), " "),
+	}
+}
+
+// unexpectedContentType reports whether the content type isn't one the APIs
+// answer with. Some servers don't set it, or send their streams as plain
+// text.
+func unexpectedContentType(ct string) bool {
+	switch {
+	case ct == "", ct == "text/event-stream", ct == "text/plain",
+		ct == "application/json", ct == "application/x-ndjson",
+		strings.HasSuffix(ct, "+json"):
+		return false
+	}
+	return true
+}
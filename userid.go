@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// machineUserID is the user-id value replaced by a hash of the machine ID.
+const machineUserID = "machine"
+
+// requestUser returns the user sent with the requests for the abuse
+// monitoring of the provider: the user-id setting, or with "machine" a hash
+// of the ID of the machine, which doesn't reveal it. Nothing is sent without
+// it.
+func (c config) requestUser() string {
+	if c.UserID != machineUserID {
+		return c.UserID
+	}
+	id := ""
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := os.ReadFile(path); err == nil {
+			id = strings.TrimSpace(string(b))
+			break
+		}
+	}
+	if id == "" {
+		// Like on macOS and Windows, the host name is stable enough.
+		id, _ = os.Hostname()
+	}
+	sum := sha256.Sum256([]byte("mods:" + id))
+	return hex.EncodeToString(sum[:16])
+}